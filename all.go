@@ -0,0 +1,71 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MigrateAll runs Migrate against each of the provided databases, such as
+// one per shard. A failure against one database doesn't stop the others from
+// being migrated; instead every failure is returned together, each
+// identifying the index of the database in dbs that it came from.
+//
+// Up to Parallelism databases are migrated at once, or one at a time if
+// Parallelism is less than 1.
+func (s *Sqlx) MigrateAll(dbs []*sql.DB, dialect string) error {
+	return s.forEachDB(dbs, func(m *Sqlx, db *sql.DB) error {
+		return m.Migrate(db, dialect)
+	})
+}
+
+// RollbackAll runs Rollback against each of the provided databases. Failures
+// are handled the same way as MigrateAll.
+func (s *Sqlx) RollbackAll(dbs []*sql.DB, dialect string) error {
+	return s.forEachDB(dbs, func(m *Sqlx, db *sql.DB) error {
+		return m.Rollback(db, dialect)
+	})
+}
+
+// forEachDB calls fn with each of dbs, at most Parallelism at a time, and
+// joins any errors that are returned. fn is passed a copy of s made by forDB
+// for each database so that those running at once don't share a Locker.
+func (s *Sqlx) forEachDB(dbs []*sql.DB, fn func(m *Sqlx, db *sql.DB) error) error {
+	parallelism := s.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	errs := make([]error, len(dbs))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, db := range dbs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, db *sql.DB) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := fn(s.forDB(), db)
+			if err != nil {
+				errs[i] = fmt.Errorf("database %d: %w", i, err)
+			}
+		}(i, db)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// forDB returns a shallow copy of s to run against one of the databases
+// passed to MigrateAll or RollbackAll. If Locker is a PostgresLocker or
+// MySQLLocker, which hold onto the connection they locked on, the copy is
+// given a new one with the same settings.
+func (s *Sqlx) forDB() *Sqlx {
+	m := *s
+	switch l := s.Locker.(type) {
+	case *PostgresLocker:
+		m.Locker = &PostgresLocker{Key: l.Key}
+	case *MySQLLocker:
+		m.Locker = &MySQLLocker{Name: l.Name, Timeout: l.Timeout}
+	}
+	return &m
+}
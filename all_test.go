@@ -0,0 +1,116 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSqlx_MigrateAll(t *testing.T) {
+	for _, parallelism := range []int{0, 3} {
+		t.Run(fmt.Sprintf("parallelism %d", parallelism), func(t *testing.T) {
+			var dbs []*sql.DB
+			for i := 0; i < 3; i++ {
+				db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", t.Name(), i))
+				if err != nil {
+					t.Fatalf("Open() err = %v; want nil", err)
+				}
+				defer db.Close()
+				dbs = append(dbs, db)
+			}
+			// Break the second shard so that its migration fails.
+			_, err := dbs[1].Exec("CREATE TABLE courses (id int);")
+			if err != nil {
+				t.Fatalf("db.Exec() err = %v; want nil", err)
+			}
+
+			migrator := migrate.Sqlx{
+				Printf: func(format string, args ...interface{}) (int, error) {
+					t.Logf(format, args...)
+					return 0, nil
+				},
+				Migrations: []migrate.SqlxMigration{
+					migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				},
+				Parallelism: parallelism,
+			}
+			err = migrator.MigrateAll(dbs, "sqlite3")
+			if err == nil {
+				t.Fatalf("MigrateAll() err = nil; want an error")
+			}
+			if !strings.Contains(err.Error(), "database 1") {
+				t.Errorf("MigrateAll() err = %v; want it to identify database 1", err)
+			}
+			if strings.Contains(err.Error(), "database 0") || strings.Contains(err.Error(), "database 2") {
+				t.Errorf("MigrateAll() err = %v; want only database 1 to fail", err)
+			}
+			assertApplied(t, dbs[0], "001_create_courses")
+			assertApplied(t, dbs[1])
+			assertApplied(t, dbs[2], "001_create_courses")
+
+			_, err = dbs[1].Exec("DROP TABLE courses;")
+			if err != nil {
+				t.Fatalf("db.Exec() err = %v; want nil", err)
+			}
+			err = migrator.MigrateAll(dbs, "sqlite3")
+			if err != nil {
+				t.Fatalf("MigrateAll() err = %v; want nil", err)
+			}
+			err = migrator.RollbackAll(dbs, "sqlite3")
+			if err != nil {
+				t.Fatalf("RollbackAll() err = %v; want nil", err)
+			}
+			for _, db := range dbs {
+				assertApplied(t, db)
+			}
+		})
+	}
+}
+
+func TestSqlx_MigrateAll_locker(t *testing.T) {
+	var dbs []*sql.DB
+	var fdbs []*fakeDB
+	for i := 0; i < 4; i++ {
+		db, fdb := openFakeNamed(t, fmt.Sprintf("%s_%d", t.Name(), i))
+		dbs = append(dbs, db)
+		fdbs = append(fdbs, fdb)
+	}
+	locker := &migrate.PostgresLocker{Key: 42}
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		},
+		Locker:      locker,
+		Parallelism: len(dbs),
+	}
+	err := migrator.MigrateAll(dbs, "postgres")
+	if err != nil {
+		t.Fatalf("MigrateAll() err = %v; want nil", err)
+	}
+	for i, fdb := range fdbs {
+		var locks, unlocks int
+		for _, stmt := range fdb.Statements() {
+			switch {
+			case strings.Contains(stmt, "pg_advisory_lock("):
+				locks++
+			case strings.Contains(stmt, "pg_advisory_unlock("):
+				unlocks++
+			}
+		}
+		if locks != 1 || unlocks != 1 {
+			t.Errorf("database %d: locks, unlocks = %d, %d; want 1, 1", i, locks, unlocks)
+		}
+	}
+	err = locker.Unlock(context.Background(), nil)
+	if err == nil {
+		t.Errorf("Unlock() err = nil; want the configured locker left unlocked")
+	}
+}
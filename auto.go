@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// AutoMigrate runs any pending migrations and is intended to be called when a
+// service starts, where several instances may start at once. If nothing is
+// pending it returns without taking a lock. Otherwise it holds a lock while
+// migrating so that only one instance runs the migrations; the others wait
+// for it and then find there is nothing left to do, which isn't an error.
+//
+// The lock used is Locker if it is set, and otherwise a PostgresLocker using
+// AdvisoryLockKey on Postgres or a MySQLLocker on MySQL. Other dialects need
+// Locker to be set to be protected from concurrent runs.
+func (s *Sqlx) AutoMigrate(sqlDB *sql.DB, dialect string) error {
+	pending, err := s.Pending(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		s.log(LevelInfo, "Database is up to date, nothing to migrate")
+		return nil
+	}
+
+	migrator := *s
+	if migrator.Locker == nil {
+		switch {
+		case postgresDialects[dialect]:
+			migrator.Locker = &PostgresLocker{Key: s.AdvisoryLockKey}
+		case dialect == "mysql":
+			migrator.Locker = &MySQLLocker{}
+		}
+	}
+	res, err := migrator.MigrateWithResult(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	if len(res.Applied) < len(pending) {
+		s.log(LevelInfo, fmt.Sprintf("Another process applied %d of %d pending migrations while waiting for the lock", len(pending)-len(res.Applied), len(pending)),
+			Field{"applied_elsewhere", len(pending) - len(res.Applied)}, Field{"pending", len(pending)})
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Default section markers used by SqlxCombinedFileMigration.
+const (
+	DefaultUpMarker   = "-- +migrate Up"
+	DefaultDownMarker = "-- +migrate Down"
+)
+
+// SqlxCombinedFileMigration will create a SqlxMigration from a single file
+// that contains both the up and down SQL, separated by marker lines:
+//
+//	-- +migrate Up
+//	CREATE TABLE users (id serial PRIMARY KEY);
+//
+//	-- +migrate Down
+//	DROP TABLE users;
+//
+// The markers can be overridden by providing them as additional arguments,
+// with the first replacing the up marker and the second replacing the down
+// marker. A marker must be on a line by itself. The up section is required,
+// but if there is no down section the migration will not have a Rollback.
+// Gzipped files are decompressed before they are parsed.
+func SqlxCombinedFileMigration(id, filename string, markers ...string) (SqlxMigration, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return SqlxMigration{}, fmt.Errorf("reading migration file: %w", err)
+	}
+	contents, err := decodeSQL(filename, b)
+	if err != nil {
+		return SqlxMigration{}, err
+	}
+	up, down, err := splitCombined(contents, markers...)
+	if err != nil {
+		return SqlxMigration{}, fmt.Errorf("parsing migration file %q: %w", filename, err)
+	}
+	return SqlxQueryMigration(id, up, down), nil
+}
+
+// splitCombined splits the contents of a combined migration file into its up
+// and down sections.
+func splitCombined(contents string, markers ...string) (up, down string, err error) {
+	upMarker, downMarker := DefaultUpMarker, DefaultDownMarker
+	if len(markers) > 0 && markers[0] != "" {
+		upMarker = markers[0]
+	}
+	if len(markers) > 1 && markers[1] != "" {
+		downMarker = markers[1]
+	}
+
+	var upLines, downLines []string
+	var section *[]string
+	var foundUp, foundDown bool
+	for _, line := range strings.Split(contents, "\n") {
+		switch strings.TrimSpace(line) {
+		case upMarker:
+			if foundUp {
+				return "", "", fmt.Errorf("multiple %q markers", upMarker)
+			}
+			foundUp = true
+			section = &upLines
+			continue
+		case downMarker:
+			if foundDown {
+				return "", "", fmt.Errorf("multiple %q markers", downMarker)
+			}
+			foundDown = true
+			section = &downLines
+			continue
+		}
+		if section == nil {
+			if strings.TrimSpace(line) != "" {
+				return "", "", errors.New("SQL found before the first marker")
+			}
+			continue
+		}
+		*section = append(*section, line)
+	}
+	if !foundUp {
+		return "", "", fmt.Errorf("missing %q marker", upMarker)
+	}
+	up = strings.TrimSpace(strings.Join(upLines, "\n"))
+	down = strings.TrimSpace(strings.Join(downLines, "\n"))
+	return up, down, nil
+}
@@ -0,0 +1,83 @@
+package migrate_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSqlxCombinedFileMigration(t *testing.T) {
+	t.Run("up and down", func(t *testing.T) {
+		m, err := migrate.SqlxCombinedFileMigration("001_create_courses", "testdata/courses.combined.sql")
+		if err != nil {
+			t.Fatalf("SqlxCombinedFileMigration() err = %v; want nil", err)
+		}
+		if m.Rollback == nil {
+			t.Fatalf("Rollback = nil; want non-nil")
+		}
+		if m.DownQuery != "DROP TABLE courses;" {
+			t.Errorf("DownQuery = %q; want %q", m.DownQuery, "DROP TABLE courses;")
+		}
+
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{m},
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ($1) ", "cor_test")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db)
+	})
+
+	t.Run("custom markers without down", func(t *testing.T) {
+		m, err := migrate.SqlxCombinedFileMigration("002_create_users", "testdata/users.combined.sql", "-- !up", "-- !down")
+		if err != nil {
+			t.Fatalf("SqlxCombinedFileMigration() err = %v; want nil", err)
+		}
+		if m.Migrate == nil {
+			t.Errorf("Migrate = nil; want non-nil")
+		}
+		if m.Rollback != nil {
+			t.Errorf("Rollback = non-nil; want nil")
+		}
+	})
+
+	for name, contents := range map[string]string{
+		"missing up marker": "CREATE TABLE courses (id int);",
+		"duplicate marker":  "-- +migrate Up\nSELECT 1;\n-- +migrate Up\nSELECT 2;",
+	} {
+		t.Run(name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "migration.sql")
+			err := os.WriteFile(filename, []byte(contents), 0644)
+			if err != nil {
+				t.Fatalf("WriteFile() err = %v; want nil", err)
+			}
+			_, err = migrate.SqlxCombinedFileMigration("001_bad", filename)
+			if err == nil {
+				t.Fatalf("SqlxCombinedFileMigration() err = nil; want error")
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := migrate.SqlxCombinedFileMigration("001_missing", "testdata/missing.sql")
+		if err == nil {
+			t.Fatalf("SqlxCombinedFileMigration() err = nil; want error")
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package migrate
+
+import "strings"
+
+// StripComments returns sql with its comments removed, leaving anything
+// inside quoted strings, quoted identifiers, and Postgres dollar-quoted
+// strings untouched. Line comments are removed up to, but not including, the
+// newline that ends them, and block comments are replaced with a single
+// space so that the tokens on either side of one aren't joined together.
+// Unterminated quotes and block comments run to the end of sql.
+//
+// The quoting rules depend on dialect, and are the same ones
+// WithStatementSplitting uses:
+//
+//   - mysql: `ident` identifiers and backslash escapes in strings. # also
+//     starts a line comment, -- only does when followed by whitespace, and
+//     executable /*! ... */ comments are kept, as are comments right after
+//     a minus sign, where removing them could turn what follows into a
+//     comment.
+//   - postgres, pgx, pq-timeouts and cloudsqlpostgres: dollar-quoted strings,
+//     backslash escapes in E'...' strings, and nested block comments.
+//   - sqlserver: [ident] identifiers and nested block comments.
+//   - sqlite3: `ident` and [ident] identifiers.
+//
+// Any other dialect gets `ident` identifiers and dollar-quoted strings,
+// without nested block comments.
+func StripComments(sql, dialect string) string {
+	r := sqlRulesFor(dialect)
+	var b strings.Builder
+	b.Grow(len(sql))
+	for i := 0; i < len(sql); {
+		kind, end := r.nextToken(sql, i)
+		if (kind == tokenLineComment || kind == tokenBlockComment) && !r.keepComment(b.String()) {
+			if kind == tokenBlockComment {
+				b.WriteByte(' ')
+			}
+			i = end
+			continue
+		}
+		b.WriteString(sql[i:end])
+		i = end
+	}
+	return b.String()
+}
+
+// keepComment reports whether a comment following stripped must be kept.
+// MySQL only treats -- as a comment when followed by whitespace, so removing
+// a comment right after a minus sign could turn what follows it into one.
+func (r sqlRules) keepComment(stripped string) bool {
+	return r.hashComments && strings.HasSuffix(stripped, "-")
+}
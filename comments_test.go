@@ -0,0 +1,141 @@
+package migrate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestStripComments(t *testing.T) {
+	tests := map[string]struct {
+		sql     string
+		dialect string
+		want    string
+	}{
+		"line comments": {
+			sql:  "-- create\nCREATE TABLE a (id int); -- done",
+			want: "\nCREATE TABLE a (id int); ",
+		},
+		"block comments": {
+			sql:  "SELECT/* a\nb */1;",
+			want: "SELECT 1;",
+		},
+		"markers in strings": {
+			sql:  `SELECT '-- a', '/* b */', "c--d", ` + "`e/*f`" + `, 'it''s -- g'; -- h`,
+			want: `SELECT '-- a', '/* b */', "c--d", ` + "`e/*f`" + `, 'it''s -- g'; `,
+		},
+		"dollar quotes": {
+			sql:     "CREATE FUNCTION f() RETURNS int AS $body$ -- kept\nSELECT /* kept */ 1 $body$; /* gone */",
+			dialect: "postgres",
+			want:    "CREATE FUNCTION f() RETURNS int AS $body$ -- kept\nSELECT /* kept */ 1 $body$;  ",
+		},
+		"dollar in identifier": {
+			sql:     "SELECT a$b$ -- gone\n, 1 $b$",
+			dialect: "postgres",
+			want:    "SELECT a$b$ \n, 1 $b$",
+		},
+		"positional parameters": {
+			sql:     "UPDATE a SET b = $1 -- gone\nWHERE c = $2",
+			dialect: "pgx",
+			want:    "UPDATE a SET b = $1 \nWHERE c = $2",
+		},
+		"escape strings": {
+			sql:     `SELECT E'it\'s -- kept', 'a\' -- gone`,
+			dialect: "postgres",
+			want:    `SELECT E'it\'s -- kept', 'a\' `,
+		},
+		"nested comments": {
+			sql:     "SELECT /* a /* b */ c */ 1",
+			dialect: "postgres",
+			want:    "SELECT   1",
+		},
+		"nested-looking comments": {
+			sql:     "SELECT /* a /* b */ c */ 1",
+			dialect: "sqlite3",
+			want:    "SELECT   c */ 1",
+		},
+		"mysql backslash escapes": {
+			sql:     `INSERT INTO a VALUES ('it\'s -- kept', "say \"/*hi*/\""); # gone`,
+			dialect: "mysql",
+			want:    `INSERT INTO a VALUES ('it\'s -- kept', "say \"/*hi*/\""); `,
+		},
+		"mysql double dash": {
+			sql:     "SELECT 1--1, 2 -- gone\n",
+			dialect: "mysql",
+			want:    "SELECT 1--1, 2 \n",
+		},
+		"mysql executable comments": {
+			sql:     "CREATE TABLE a (id int) /*!50100 ENGINE=InnoDB */ /* gone */;",
+			dialect: "mysql",
+			want:    "CREATE TABLE a (id int) /*!50100 ENGINE=InnoDB */  ;",
+		},
+		"mysql comment after minus": {
+			sql:     "SELECT 1--/**/ 1",
+			dialect: "mysql",
+			want:    "SELECT 1--/**/ 1",
+		},
+		"sqlserver brackets": {
+			sql:     "SELECT [a--b], [c]]/*d] /* gone /* nested */ */",
+			dialect: "sqlserver",
+			want:    "SELECT [a--b], [c]]/*d]  ",
+		},
+		"unterminated": {
+			sql:  "SELECT 'a -- b",
+			want: "SELECT 'a -- b",
+		},
+		"unterminated comment": {
+			sql:  "SELECT 1 /* 'a",
+			want: "SELECT 1  ",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := migrate.StripComments(tc.sql, tc.dialect)
+			if got != tc.want {
+				t.Errorf("StripComments() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func FuzzStripComments(f *testing.F) {
+	for _, seed := range []string{
+		"SELECT 1; -- a\n/* b */ SELECT 2;",
+		`SELECT '-- a', "/* b */", ` + "`--`" + `, [/*], 'it''s';`,
+		"SELECT /* a /* b */ c */ 1 -/**/-1",
+		"CREATE FUNCTION f() AS $$ -- a $$; SELECT $1, a$b$;",
+		`SELECT E'\'--', 'a\' -- b', "c\"/*" # d`,
+		"SELECT 1--1 /*! e */ --#0",
+		"'unterminated /*",
+		`INSERT INTO t VALUES ('it\'s; x'); SELECT [a;b]; /*!50100 SET x=1; */`,
+		"DELIMITER //\nSELECT 1; SELECT 2 //\ndelimiter ;\nSELECT 3;",
+	} {
+		f.Add(seed)
+	}
+	dialects := []string{"", "mysql", "postgres", "sqlite3", "sqlserver"}
+	f.Fuzz(func(t *testing.T, sql string) {
+		for _, dialect := range dialects {
+			got := migrate.StripComments(sql, dialect)
+			if len(got) > len(sql) {
+				t.Errorf("StripComments(%q, %q) = %q; want no longer than the input", sql, dialect, got)
+			}
+			if again := migrate.StripComments(got, dialect); again != got {
+				t.Errorf("StripComments(%q, %q) = %q; stripped again = %q; want unchanged", sql, dialect, got, again)
+			}
+			if !strings.Contains(sql, "--") && !strings.Contains(sql, "/*") && !strings.Contains(sql, "#") && got != sql {
+				t.Errorf("StripComments(%q, %q) = %q; want input without comment markers unchanged", sql, dialect, got)
+			}
+
+			stmts := migrate.SplitStatements(sql, dialect)
+			for _, stmt := range stmts {
+				if stmt == "" || !strings.Contains(sql, stmt) {
+					t.Errorf("SplitStatements(%q, %q) = %q; want non-empty parts of the input", sql, dialect, stmts)
+				}
+			}
+			if len(stmts) > 1 && !strings.Contains(sql, ";") && !strings.Contains(strings.ToUpper(sql), "DELIMITER") {
+				t.Errorf("SplitStatements(%q, %q) = %q; want at most one statement without a delimiter", sql, dialect, stmts)
+			}
+		}
+	})
+}
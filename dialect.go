@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrUnsupportedDialect is returned when the dialect passed to the migrator
+// isn't one that sqlx knows how to bind parameters for.
+var ErrUnsupportedDialect = errors.New("unsupported dialect")
+
+// supportedDialects are the driver names sqlx.BindType recognizes.
+var supportedDialects = []string{
+	"cloudsqlpostgres",
+	"goracle",
+	"mysql",
+	"oci8",
+	"ora",
+	"pgx",
+	"postgres",
+	"pq-timeouts",
+	"sqlite3",
+	"sqlserver",
+}
+
+// checkDialect returns ErrUnsupportedDialect if dialect isn't recognized.
+func checkDialect(dialect string) error {
+	if sqlx.BindType(dialect) == sqlx.UNKNOWN {
+		return fmt.Errorf("%w: %q (supported dialects: %s)", ErrUnsupportedDialect, dialect, strings.Join(supportedDialects, ", "))
+	}
+	return nil
+}
+
+// newDB wraps sqlDB for use with sqlx, returning ErrUnsupportedDialect if
+// dialect isn't recognized.
+func newDB(sqlDB *sql.DB, dialect string) (*sqlx.DB, error) {
+	err := checkDialect(dialect)
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.NewDb(sqlDB, dialect), nil
+}
+
+// alreadyExistsErrors are fragments of the errors databases return when a
+// table or column being created already exists. They are matched against the
+// error text so that the driver packages don't need to be imported.
+var alreadyExistsErrors = []string{
+	"already exists",                            // postgres (42P07, 42701), mysql (1050), sqlite
+	"pg_type_typname_nsp_index",                 // postgres, racing CREATE TABLE IF NOT EXISTS
+	"duplicate column name",                     // mysql (1060), sqlite
+	"there is already an object named",          // sqlserver (2714)
+	"column names in each table must be unique", // sqlserver (2705)
+}
+
+// isAlreadyExists reports whether err is a database's way of saying the
+// table or column being created already exists. CREATE TABLE IF NOT EXISTS
+// isn't atomic on every database, so two processes creating the migrations
+// table at once can see these errors even though the table is now there.
+func isAlreadyExists(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, frag := range alreadyExistsErrors {
+		if strings.Contains(msg, frag) {
+			return true
+		}
+	}
+	return false
+}
+
+// columnTypes are the column types used by the tables this package creates.
+type columnTypes struct {
+	// key is used for text columns that are part of a primary key.
+	key       string
+	text      string
+	timestamp string
+	boolean   string
+}
+
+// columnTypesFor returns the column types to use for dialect. Neither MySQL
+// nor SQL Server can use TEXT in a primary key. SQL Server's TIMESTAMP is a
+// row version rather than a point in time, and MySQL's may be updated
+// automatically, so both use a DATETIME type instead.
+func columnTypesFor(dialect string) columnTypes {
+	switch dialect {
+	case "mysql":
+		return columnTypes{key: "VARCHAR(255)", text: "TEXT", timestamp: "DATETIME(6)", boolean: "BOOLEAN"}
+	case "sqlserver":
+		return columnTypes{key: "NVARCHAR(255)", text: "NVARCHAR(MAX)", timestamp: "DATETIME2", boolean: "BIT"}
+	}
+	return columnTypes{key: "TEXT", text: "TEXT", timestamp: "TIMESTAMP", boolean: "BOOLEAN"}
+}
+
+// createTableSQL returns a statement that creates table with the provided
+// column definitions if it doesn't already exist. SQL Server doesn't support
+// CREATE TABLE IF NOT EXISTS, so it checks sys.tables first instead.
+func createTableSQL(dialect, table, columns string) string {
+	if dialect == "sqlserver" {
+		return "IF NOT EXISTS (SELECT * FROM sys.tables WHERE object_id = OBJECT_ID(N'" + table + "')) CREATE TABLE " + table + " (" + columns + ")"
+	}
+	return "CREATE TABLE IF NOT EXISTS " + table + " (" + columns + ")"
+}
+
+// addColumnSQL returns a statement that adds a column to table.
+func addColumnSQL(dialect, table, column, columnType string) string {
+	if dialect == "sqlserver" {
+		return "ALTER TABLE " + table + " ADD " + column + " " + columnType
+	}
+	return "ALTER TABLE " + table + " ADD COLUMN " + column + " " + columnType
+}
+
+// quoteIdent quotes an identifier for dialect. It assumes the identifier
+// doesn't contain any quote characters.
+func quoteIdent(dialect, ident string) string {
+	switch dialect {
+	case "mysql":
+		return "`" + ident + "`"
+	case "sqlserver":
+		return "[" + ident + "]"
+	}
+	return `"` + ident + `"`
+}
+
+// savepointStatements are the statements used to run a migration within a
+// savepoint of a larger transaction.
+type savepointStatements struct {
+	create, release, rollback string
+}
+
+// savepointSQL returns the statements that create, release, and roll back to
+// a savepoint named name. SQL Server uses its own syntax and has no way to
+// release a savepoint, so release is left empty for it.
+func savepointSQL(dialect, name string) savepointStatements {
+	if dialect == "sqlserver" {
+		return savepointStatements{
+			create:   "SAVE TRANSACTION " + name,
+			rollback: "ROLLBACK TRANSACTION " + name,
+		}
+	}
+	return savepointStatements{
+		create:   "SAVEPOINT " + name,
+		release:  "RELEASE SAVEPOINT " + name,
+		rollback: "ROLLBACK TO SAVEPOINT " + name,
+	}
+}
@@ -0,0 +1,379 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/joncalhoun/migrate"
+)
+
+// fakeDriver is a database/sql driver that records every statement it is
+// given and keeps just enough state about the migrations table for Migrate,
+// Rollback, and Status to work. It lets the statements generated for
+// dialects we can't run in tests, such as SQL Server, be checked end to end.
+// Databases are keyed by the name passed to sql.Open.
+type fakeDriver struct {
+	mu  sync.Mutex
+	dbs map[string]*fakeDB
+}
+
+type fakeDB struct {
+	mu         sync.Mutex
+	statements []string
+	// applied holds the args of each INSERT into the migrations table,
+	// keyed by ID.
+	applied map[string][]driver.Value
+	// txOptions holds the options of each transaction begun, in order.
+	txOptions []driver.TxOptions
+	// prepared holds every statement prepared, in order.
+	prepared []string
+	// noPrepare makes preparing a statement fail, as it does with drivers
+	// that don't support prepared statements.
+	noPrepare bool
+	// lockTimeouts holds the timeout passed to each GET_LOCK, in order.
+	lockTimeouts []driver.Value
+}
+
+var fakeDrv = &fakeDriver{dbs: make(map[string]*fakeDB)}
+
+func init() {
+	sql.Register("migrate_fake", fakeDrv)
+}
+
+// openFake opens a fake database for the current test, returning it along
+// with the fakeDB used to inspect what was run.
+func openFake(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+	return openFakeNamed(t, t.Name())
+}
+
+// openFakeNamed is like openFake, but for tests that need more than one fake
+// database, each with its own name.
+func openFakeNamed(t *testing.T, name string) (*sql.DB, *fakeDB) {
+	t.Helper()
+	db, err := sql.Open("migrate_fake", name)
+	if err != nil {
+		t.Fatalf("Open() err = %v; want nil", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	fakeDrv.mu.Lock()
+	defer fakeDrv.mu.Unlock()
+	fdb := &fakeDB{applied: make(map[string][]driver.Value)}
+	fakeDrv.dbs[name] = fdb
+	return db, fdb
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	fdb, ok := d.dbs[name]
+	if !ok {
+		return nil, errors.New("fake: unknown database " + name)
+	}
+	return fakeConn{fdb}, nil
+}
+
+// LockTimeouts returns the timeout passed to each GET_LOCK so far.
+func (db *fakeDB) LockTimeouts() []driver.Value {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]driver.Value(nil), db.lockTimeouts...)
+}
+
+// Statements returns every statement run so far.
+func (db *fakeDB) Statements() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.statements...)
+}
+
+// TxOptions returns the options of every transaction begun so far.
+func (db *fakeDB) TxOptions() []driver.TxOptions {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]driver.TxOptions(nil), db.txOptions...)
+}
+
+// Prepared returns every statement prepared so far.
+func (db *fakeDB) Prepared() []string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]string(nil), db.prepared...)
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if c.db.noPrepare {
+		return nil, errors.New("fake: prepared statements are not supported")
+	}
+	c.db.prepared = append(c.db.prepared, query)
+	return fakeStmt{conn: c, query: query}, nil
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return noopTx{}, nil }
+
+func (c fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.txOptions = append(c.db.txOptions, opts)
+	return noopTx{}, nil
+}
+
+func (c fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.statements = append(c.db.statements, query)
+	switch {
+	case strings.HasPrefix(query, "INSERT INTO migrations "):
+		values := make([]driver.Value, len(args))
+		for i, arg := range args {
+			values[i] = arg.Value
+		}
+		c.db.applied[values[0].(string)] = values
+	case strings.HasPrefix(query, "DELETE FROM migrations "):
+		delete(c.db.applied, args[0].Value.(string))
+	case strings.HasPrefix(strings.TrimSpace(query), "CREATE "):
+		// Like some real drivers, don't report rows affected by DDL.
+		return driver.ResultNoRows, nil
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.statements = append(c.db.statements, query)
+	switch {
+	case strings.HasPrefix(query, "SELECT COUNT(*)"):
+		return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{int64(1)}}}, nil
+	case strings.HasPrefix(query, "SELECT GET_LOCK("):
+		c.db.lockTimeouts = append(c.db.lockTimeouts, args[1].Value)
+		return &fakeRows{columns: []string{"got"}, values: [][]driver.Value{{int64(1)}}}, nil
+	case strings.HasPrefix(query, "SELECT id, "):
+		rows := &fakeRows{columns: []string{"id", "checksum", "applied_at", "dirty", "description"}}
+		for _, values := range c.db.applied {
+			row := append([]driver.Value(nil), values...)
+			if row[1] == nil {
+				row[1] = ""
+			}
+			if row[4] == nil {
+				row[4] = ""
+			}
+			rows.values = append(rows.values, row)
+		}
+		sort.Slice(rows.values, func(i, j int) bool {
+			return rows.values[i][0].(string) < rows.values[j][0].(string)
+		})
+		return rows, nil
+	}
+	return &fakeRows{columns: []string{"column"}}, nil
+}
+
+// fakeStmt runs its query with the connection it was prepared on.
+type fakeStmt struct {
+	conn  fakeConn
+	query string
+}
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.conn.ExecContext(ctx, s.query, args)
+}
+
+func (s fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.conn.QueryContext(ctx, s.query, args)
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: arg}
+	}
+	return named
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+func TestSQLServer(t *testing.T) {
+	db, fdb := openFake(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", "CREATE TABLE courses (id INT PRIMARY KEY, name NVARCHAR(255));", "DROP TABLE courses;"),
+			migrate.SqlxQueryMigration("002_create_users", "CREATE TABLE users (id INT PRIMARY KEY);", "DROP TABLE users;"),
+		},
+		HistoryTable: "migration_history",
+	}
+	err := migrator.Migrate(db, "sqlserver")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	err = migrator.RollbackN(db, "sqlserver", 1)
+	if err != nil {
+		t.Fatalf("RollbackN() err = %v; want nil", err)
+	}
+	statuses, err := migrator.Status(db, "sqlserver")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("Status() = %+v; want only 001_create_courses applied", statuses)
+	}
+
+	statements := fdb.Statements()
+	for _, want := range []string{
+		"IF NOT EXISTS (SELECT * FROM sys.tables WHERE object_id = OBJECT_ID(N'migrations')) CREATE TABLE migrations (id NVARCHAR(255) PRIMARY KEY, checksum NVARCHAR(MAX), applied_at DATETIME2, dirty BIT, description NVARCHAR(MAX))",
+		"IF NOT EXISTS (SELECT * FROM sys.tables WHERE object_id = OBJECT_ID(N'migration_history')) CREATE TABLE migration_history (id NVARCHAR(255) NOT NULL, direction NVARCHAR(255) NOT NULL, applied_at DATETIME2 NOT NULL)",
+		"INSERT INTO migrations (id, checksum, applied_at, dirty, description) VALUES (@p1, @p2, @p3, @p4, @p5)",
+		"DELETE FROM migrations WHERE id=@p1",
+		"INSERT INTO migration_history (id, direction, applied_at) VALUES (@p1, @p2, @p3)",
+	} {
+		found := false
+		for _, stmt := range statements {
+			found = found || stmt == want
+		}
+		if !found {
+			t.Errorf("statements don't include %q", want)
+		}
+	}
+	for _, stmt := range statements {
+		if strings.Contains(stmt, "?") || strings.Contains(stmt, "$1") || strings.HasPrefix(stmt, "CREATE TABLE IF NOT EXISTS") {
+			t.Errorf("statement %q isn't valid on SQL Server", stmt)
+		}
+	}
+}
+
+func TestMySQL(t *testing.T) {
+	newMigrator := func(t *testing.T) migrate.Sqlx {
+		return migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", "CREATE TABLE migrate_test_courses (id INT PRIMARY KEY, name TEXT);", "DROP TABLE migrate_test_courses;"),
+				migrate.SqlxQueryMigration("002_create_users", "CREATE TABLE migrate_test_users (id INT PRIMARY KEY);", "DROP TABLE migrate_test_users;"),
+			},
+			TableName:    "migrate_test_migrations",
+			HistoryTable: "migrate_test_history",
+		}
+	}
+
+	t.Run("statements", func(t *testing.T) {
+		db, fdb := openFake(t)
+		migrator := newMigrator(t)
+		err := migrator.Migrate(db, "mysql")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		statements := fdb.Statements()
+		for _, want := range []string{
+			"CREATE TABLE IF NOT EXISTS migrate_test_migrations (id VARCHAR(255) PRIMARY KEY, checksum TEXT, applied_at DATETIME(6), dirty BOOLEAN, description TEXT)",
+			"CREATE TABLE IF NOT EXISTS migrate_test_history (id VARCHAR(255) NOT NULL, direction VARCHAR(255) NOT NULL, applied_at DATETIME(6) NOT NULL)",
+		} {
+			found := false
+			for _, stmt := range statements {
+				found = found || stmt == want
+			}
+			if !found {
+				t.Errorf("statements = %q; want them to include %q", statements, want)
+			}
+		}
+	})
+
+	// The integration test runs against a real MySQL database when
+	// MIGRATE_MYSQL_DSN is set, such as:
+	//
+	//	MIGRATE_MYSQL_DSN='root:secret@tcp(localhost:3306)/migrate_test' go test -run TestMySQL
+	t.Run("integration", func(t *testing.T) {
+		dsn := os.Getenv("MIGRATE_MYSQL_DSN")
+		if dsn == "" {
+			t.Skip("MIGRATE_MYSQL_DSN not set")
+		}
+		db, err := sql.Open("mysql", dsn)
+		if err != nil {
+			t.Fatalf("Open() err = %v; want nil", err)
+		}
+		defer db.Close()
+		cleanup := func() {
+			for _, table := range []string{"migrate_test_users", "migrate_test_courses", "migrate_test_migrations", "migrate_test_history"} {
+				db.Exec("DROP TABLE IF EXISTS " + table)
+			}
+		}
+		cleanup()
+		defer cleanup()
+
+		migrator := newMigrator(t)
+		err = migrator.Migrate(db, "mysql")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		// Running again exercises reading back the recorded migrations.
+		err = migrator.Migrate(db, "mysql")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		statuses, err := migrator.Status(db, "mysql")
+		if err != nil {
+			t.Fatalf("Status() err = %v; want nil", err)
+		}
+		for _, st := range statuses {
+			if !st.Applied || st.AppliedAt.IsZero() {
+				t.Errorf("Status(%q) = %+v; want applied with a time", st.ID, st)
+			}
+		}
+		err = migrator.Rollback(db, "mysql")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM migrate_test_migrations").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 0 {
+			t.Errorf("recorded migrations = %d; want 0", n)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package migrate
+
+import "time"
+
+// Outcome is what happened to a migration during a run.
+type Outcome string
+
+// Outcomes reported in a StepEvent.
+const (
+	// OutcomeApplied means the migration was run, or rolled back if the
+	// event's Direction is DirectionDown.
+	OutcomeApplied Outcome = "applied"
+	// OutcomeSkipped means nothing needed to be done, such as a migration
+	// that had already been run.
+	OutcomeSkipped Outcome = "skipped"
+	// OutcomeFailed means the migration or rollback returned an error.
+	OutcomeFailed Outcome = "failed"
+)
+
+// StepEvent describes a single migration or rollback considered during a
+// run. It carries enough information to drive counters of applied, skipped,
+// and failed migrations as well as a histogram of their durations.
+type StepEvent struct {
+	ID string
+	// Direction is DirectionUp for migrations and DirectionDown for
+	// rollbacks.
+	Direction string
+	Outcome   Outcome
+	// Duration is how long the step took, including the BeforeEach and
+	// AfterEach hooks. It is zero for skipped steps.
+	Duration time.Duration
+	// Err is the error the step failed with, if any.
+	Err error
+}
+
+// event reports e to OnEvent, if it is set, and sends the matching
+// MigrationEvent to Events.
+func (s *Sqlx) event(e StepEvent) {
+	if s.OnEvent != nil {
+		s.OnEvent(e)
+	}
+	phase := PhaseDone
+	switch e.Outcome {
+	case OutcomeSkipped:
+		phase = PhaseSkip
+	case OutcomeFailed:
+		phase = PhaseError
+	}
+	s.send(MigrationEvent{Phase: phase, ID: e.ID, Direction: e.Direction, Duration: e.Duration, Err: e.Err})
+}
+
+// Phase is the point a migration has reached in a MigrationEvent.
+type Phase string
+
+// Phases reported in a MigrationEvent.
+const (
+	// PhaseStart means the migration or rollback is about to be run.
+	PhaseStart Phase = "start"
+	// PhaseSkip means nothing needed to be done, such as a migration that
+	// had already been run.
+	PhaseSkip Phase = "skip"
+	// PhaseDone means the migration or rollback finished successfully.
+	PhaseDone Phase = "done"
+	// PhaseError means the migration or rollback returned an error.
+	PhaseError Phase = "error"
+)
+
+// MigrationEvent is sent to Sqlx.Events as each migration or rollback
+// progresses. Every migration that is run is sent with PhaseStart followed
+// by either PhaseDone or PhaseError.
+type MigrationEvent struct {
+	Phase Phase
+	ID    string
+	// Direction is DirectionUp for migrations and DirectionDown for
+	// rollbacks.
+	Direction string
+	// Duration is how long the step took. It is only set for PhaseDone and
+	// PhaseError.
+	Duration time.Duration
+	// Err is the error the step failed with, for PhaseError.
+	Err error
+}
+
+// started sends a PhaseStart event for m to Events.
+func (s *Sqlx) started(m SqlxMigration, direction string) {
+	s.send(MigrationEvent{Phase: PhaseStart, ID: m.ID, Direction: direction})
+}
+
+// send sends e to Events, if it is set, without blocking. If the channel
+// isn't ready to receive, e is dropped so that a slow consumer can't stall
+// the migrator.
+func (s *Sqlx) send(e MigrationEvent) {
+	if s.Events == nil {
+		return
+	}
+	select {
+	case s.Events <- e:
+	default:
+	}
+}
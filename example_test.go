@@ -0,0 +1,190 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joncalhoun/migrate"
+)
+
+// This example wires OnEvent up to metrics. The maps stand in for counter and
+// histogram vectors from a metrics library such as Prometheus, labeled by
+// direction and outcome.
+func ExampleSqlx_OnEvent() {
+	db, err := sql.Open("sqlite3", "file:ExampleSqlx_OnEvent?mode=memory&cache=shared")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	counts := make(map[string]int)
+	durations := make(map[string][]time.Duration)
+	migrator := migrate.Sqlx{
+		Printf: migrate.DiscardPrintf,
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			migrate.SqlxQueryMigration("003_broken", "NOT VALID SQL", ""),
+		},
+		OnEvent: func(e migrate.StepEvent) {
+			label := e.Direction + " " + string(e.Outcome)
+			// eg: migrationsTotal.WithLabelValues(e.Direction, string(e.Outcome)).Inc()
+			counts[label]++
+			if e.Outcome != migrate.OutcomeSkipped {
+				// eg: migrationDuration.WithLabelValues(e.Direction).Observe(e.Duration.Seconds())
+				durations[e.Direction] = append(durations[e.Direction], e.Duration)
+			}
+		},
+	}
+	_ = migrator.MigrateN(db, "sqlite3", 1)
+	_ = migrator.Migrate(db, "sqlite3")
+
+	var labels []string
+	for label := range counts {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		fmt.Printf("%s: %d\n", label, counts[label])
+	}
+	fmt.Printf("durations observed: %d\n", len(durations[migrate.DirectionUp]))
+
+	// Output:
+	// up applied: 2
+	// up failed: 1
+	// up skipped: 1
+	// durations observed: 3
+}
+
+// This example wraps each migration in a tracing span. With OpenTelemetry
+// the Tracer would look something like:
+//
+//	tracer := otel.Tracer("migrate")
+//	migrator.Tracer = func(ctx context.Context, id string) (context.Context, func(error)) {
+//		ctx, span := tracer.Start(ctx, "migration "+id, trace.WithAttributes(
+//			attribute.String("migration.id", id),
+//			attribute.String("db.system", dialect),
+//		))
+//		return ctx, func(err error) {
+//			if err != nil {
+//				span.RecordError(err)
+//				span.SetStatus(codes.Error, err.Error())
+//			}
+//			span.End()
+//		}
+//	}
+//
+// and the whole run would be wrapped in a parent span by starting one before
+// calling MigrateContext. Here a simple stand-in records the spans instead.
+func ExampleSqlx_Tracer() {
+	db, err := sql.Open("sqlite3", "file:ExampleSqlx_Tracer?mode=memory&cache=shared")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	type spanKey struct{}
+	migrator := migrate.Sqlx{
+		Printf: migrate.DiscardPrintf,
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		},
+		Tracer: func(ctx context.Context, id string) (context.Context, func(error)) {
+			parent, _ := ctx.Value(spanKey{}).(string)
+			fmt.Printf("start %s (parent: %s)\n", id, parent)
+			return context.WithValue(ctx, spanKey{}, id), func(err error) {
+				fmt.Printf("end %s (err: %v)\n", id, err)
+			}
+		},
+	}
+	ctx := context.WithValue(context.Background(), spanKey{}, "migrate run")
+	err = migrator.MigrateContext(ctx, db, "sqlite3")
+	if err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// start 001_create_courses (parent: migrate run)
+	// end 001_create_courses (err: <nil>)
+	// start 002_create_users (parent: migrate run)
+	// end 002_create_users (err: <nil>)
+}
+
+// This example backfills a derived column in batches. Each batch is read and
+// transformed in Go, and the whole backfill runs inside the migration's
+// transaction so it either completes or leaves the table untouched.
+func ExampleSqlxFuncMigration() {
+	db, err := sql.Open("sqlite3", "file:ExampleSqlxFuncMigration?mode=memory&cache=shared")
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	const batchSize = 2
+	backfillSlugs := func(ctx context.Context, tx *sqlx.Tx) error {
+		lastID := 0
+		for {
+			var batch []struct {
+				ID   int    `db:"id"`
+				Name string `db:"name"`
+			}
+			err := tx.SelectContext(ctx, &batch, "SELECT id, name FROM courses WHERE id > ? ORDER BY id LIMIT ?", lastID, batchSize)
+			if err != nil {
+				return err
+			}
+			if len(batch) == 0 {
+				return nil
+			}
+			for _, row := range batch {
+				slug := strings.ReplaceAll(strings.ToLower(row.Name), " ", "-")
+				_, err = tx.ExecContext(ctx, "UPDATE courses SET slug = ? WHERE id = ?", slug, row.ID)
+				if err != nil {
+					return err
+				}
+			}
+			lastID = batch[len(batch)-1].ID
+		}
+	}
+
+	migrator := migrate.Sqlx{
+		Printf: migrate.DiscardPrintf,
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", `
+CREATE TABLE courses (id INTEGER PRIMARY KEY, name TEXT);
+INSERT INTO courses (name) VALUES ('Intro to Go'), ('Web Development'), ('Test With Go');`, ""),
+			migrate.SqlxQueryMigration("002_add_slug", "ALTER TABLE courses ADD COLUMN slug TEXT;", ""),
+			migrate.SqlxFuncMigration("003_backfill_slug", backfillSlugs, func(ctx context.Context, tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, "UPDATE courses SET slug = NULL")
+				return err
+			}),
+		},
+	}
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		panic(err)
+	}
+
+	rows, err := db.Query("SELECT slug FROM courses ORDER BY id")
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			panic(err)
+		}
+		fmt.Println(slug)
+	}
+
+	// Output:
+	// intro-to-go
+	// web-development
+	// test-with-go
+}
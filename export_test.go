@@ -0,0 +1,17 @@
+package migrate
+
+// SplitStatements exposes splitStatements to the migrate_test package.
+var SplitStatements = splitStatements
+
+// SortedIDs returns the IDs of s's migrations in the order they are run.
+func SortedIDs(s *Sqlx) ([]string, error) {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(migrations))
+	for i, m := range migrations {
+		ids[i] = m.ID
+	}
+	return ids, nil
+}
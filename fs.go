@@ -0,0 +1,331 @@
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fsMigrationName matches files named like 001_create_users.up.sql, or
+// 001_create_users.up.sql.gz when gzipped.
+var fsMigrationName = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql(\.gz)?$`)
+
+// FSMigrations will create a SqlxMigration for each pair of SQL files in the
+// provided directory of fsys. Files must be named NNN_name.up.sql and
+// NNN_name.down.sql, where NNN is a number used to order the migrations and
+// NNN_name is used as the migration ID. The down file is optional. Files may
+// be gzipped and named with a .sql.gz extension instead, in which case they
+// are decompressed when they are read. Other files are ignored.
+//
+// This works well with embed.FS:
+//
+//	//go:embed migrations/*.sql
+//	var migrationFS embed.FS
+//
+//	migrations, err := migrate.FSMigrations(migrationFS, "migrations")
+func FSMigrations(fsys fs.FS, dir string) ([]SqlxMigration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return numberedMigrations(names, func(name string) ([]byte, error) {
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading migration file: %w", err)
+		}
+		return b, nil
+	})
+}
+
+// numberedMigrations creates a SqlxMigration for each pair of SQL files in
+// names following the naming rules of FSMigrations, using read to get the
+// contents of each file.
+func numberedMigrations(names []string, read func(name string) ([]byte, error)) ([]SqlxMigration, error) {
+	type fsMigration struct {
+		num              uint64
+		id               string
+		upName, downName string
+		up, down         string
+	}
+	byNum := make(map[uint64]*fsMigration)
+	for _, name := range names {
+		if !isSQLFile(name) {
+			continue
+		}
+		match := fsMigrationName.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("malformed migration filename %q: want NNN_name.up.sql or NNN_name.down.sql", name)
+		}
+		num, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed migration filename %q: %w", name, err)
+		}
+		id := match[1] + "_" + match[2]
+		fm, ok := byNum[num]
+		if !ok {
+			fm = &fsMigration{num: num, id: id}
+			byNum[num] = fm
+		}
+		if fm.id != id {
+			return nil, fmt.Errorf("duplicate migration prefix %q: %q and %q", match[1], fm.id, id)
+		}
+		prev := &fm.upName
+		if match[3] == "down" {
+			prev = &fm.downName
+		}
+		if *prev != "" {
+			return nil, fmt.Errorf("duplicate migration file for %q: %q and %q", id, *prev, name)
+		}
+		*prev = name
+		b, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+		query, err := decodeSQL(name, b)
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			fm.up = query
+		} else {
+			fm.down = query
+		}
+	}
+
+	sorted := make([]*fsMigration, 0, len(byNum))
+	for _, fm := range byNum {
+		if fm.upName == "" {
+			return nil, fmt.Errorf("migration %q has a down file but no up file", fm.id)
+		}
+		sorted = append(sorted, fm)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].num < sorted[j].num
+	})
+	migrations := make([]SqlxMigration, 0, len(sorted))
+	for _, fm := range sorted {
+		migrations = append(migrations, SqlxQueryMigration(fm.id, fm.up, fm.down))
+	}
+	return migrations, nil
+}
+
+// DirMigrations will create a SqlxMigration for each pair of SQL files in the
+// directory at path on disk, following the same naming rules as
+// FSMigrations. It is intended for migrations shipped alongside a binary
+// rather than embedded in it.
+func DirMigrations(path string) ([]SqlxMigration, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("reading migrations directory: %q is not a directory", path)
+	}
+	return FSMigrations(os.DirFS(path), ".")
+}
+
+// GlobMigrations will create a SqlxMigration for each file in fsys matching
+// pattern, using the syntax of fs.Glob. Directories that match are ignored.
+//
+// The migration ID is derived from the base name of each file:
+//
+//   - A name ending in ".gz" has that suffix removed first, and the file is
+//     decompressed when it is read.
+//   - A name ending in ".up.sql" or ".down.sql" has that suffix removed, and
+//     the file is used as the migration's up or down SQL respectively. A down
+//     file is optional, but one without a matching up file is an error.
+//   - Any other name has its final extension, as reported by path.Ext,
+//     removed and the file is used as an up-only migration. For example
+//     "002_seed.sql" becomes "002_seed" and "002_seed.tar.sql" becomes
+//     "002_seed.tar".
+//
+// Only the base name is used, so files in different directories must not
+// derive the same ID; ErrDuplicateID is returned if they do. Migrations are
+// sorted by their IDs using CompareIDs, so "2_users" comes before
+// "10_widgets".
+func GlobMigrations(fsys fs.FS, pattern string) ([]SqlxMigration, error) {
+	matches, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("matching migration files: %w", err)
+	}
+
+	type globMigration struct {
+		id             string
+		up, down       string
+		hasUp, hasDown bool
+	}
+	byID := make(map[string]*globMigration)
+	for _, match := range matches {
+		info, err := fs.Stat(fsys, match)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration file: %w", err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		name := path.Base(match)
+		base := strings.TrimSuffix(name, ".gz")
+		var id string
+		isDown := false
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			id = strings.TrimSuffix(base, ".up.sql")
+		case strings.HasSuffix(base, ".down.sql"):
+			id = strings.TrimSuffix(base, ".down.sql")
+			isDown = true
+		default:
+			id = strings.TrimSuffix(base, path.Ext(base))
+		}
+		gm, ok := byID[id]
+		if !ok {
+			gm = &globMigration{id: id}
+			byID[id] = gm
+		}
+		if (isDown && gm.hasDown) || (!isDown && gm.hasUp) {
+			return nil, fmt.Errorf("%w: %q from %q", ErrDuplicateID, id, match)
+		}
+		b, err := fs.ReadFile(fsys, match)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration file: %w", err)
+		}
+		query, err := decodeSQL(name, b)
+		if err != nil {
+			return nil, err
+		}
+		if isDown {
+			gm.down, gm.hasDown = query, true
+		} else {
+			gm.up, gm.hasUp = query, true
+		}
+	}
+
+	sorted := make([]*globMigration, 0, len(byID))
+	for _, gm := range byID {
+		if !gm.hasUp {
+			return nil, fmt.Errorf("migration %q has a down file but no up file", gm.id)
+		}
+		sorted = append(sorted, gm)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return CompareIDs(sorted[i].id, sorted[j].id) < 0
+	})
+	migrations := make([]SqlxMigration, 0, len(sorted))
+	for _, gm := range sorted {
+		migrations = append(migrations, SqlxQueryMigration(gm.id, gm.up, gm.down))
+	}
+	return migrations, nil
+}
+
+// golangMigrateName matches the file names used by golang-migrate, such as
+// 0001_create_users.up.sql. The title may be empty.
+var golangMigrateName = regexp.MustCompile(`^([0-9]+)_(.*)\.(up|down)\.sql(\.gz)?$`)
+
+// GolangMigrateMigrations will create a SqlxMigration for each migration in
+// the provided directory of fsys that follows golang-migrate's naming
+// convention, so that projects switching from golang-migrate can keep their
+// files as they are. Files are named VERSION_TITLE.up.sql and
+// VERSION_TITLE.down.sql, where VERSION is an unsigned integer that may be
+// zero padded and TITLE may be empty. Migrations are ordered by VERSION
+// numerically and VERSION_TITLE is used as the migration ID. As with
+// golang-migrate, files that don't match the convention are ignored, and two
+// migrations with the same VERSION, such as 1_a and 0001_b, are an error.
+//
+// The down file is optional. As with FSMigrations, a migration without one
+// has no rollback, and the ErrNoRollback returned by RequireRollback and
+// Redo names the missing down file. Gzipped files named with a .sql.gz
+// extension are decompressed when they are read.
+//
+// Note: the migrations are recorded in this package's migrations table, not
+// golang-migrate's schema_migrations table. When switching an existing
+// database over, use SetVersion to record the migrations that have already
+// been applied.
+func GolangMigrateMigrations(fsys fs.FS, dir string) ([]SqlxMigration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migrations directory: %w", err)
+	}
+
+	type gmMigration struct {
+		version          uint64
+		id               string
+		upName, downName string
+		up, down         string
+	}
+	byVersion := make(map[uint64]*gmMigration)
+	for _, entry := range entries {
+		name := entry.Name()
+		match := golangMigrateName.FindStringSubmatch(name)
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed migration filename %q: %w", name, err)
+		}
+		id := match[1] + "_" + match[2]
+		gm, ok := byVersion[version]
+		if !ok {
+			gm = &gmMigration{version: version, id: id}
+			byVersion[version] = gm
+		}
+		if gm.id != id {
+			return nil, fmt.Errorf("duplicate migration version %d: %q and %q", version, gm.id, id)
+		}
+		b, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("reading migration file: %w", err)
+		}
+		query, err := decodeSQL(name, b)
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			if gm.upName != "" {
+				return nil, fmt.Errorf("duplicate migration file for version %d: %q and %q", version, gm.upName, name)
+			}
+			gm.upName, gm.up = name, query
+		} else {
+			if gm.downName != "" {
+				return nil, fmt.Errorf("duplicate migration file for version %d: %q and %q", version, gm.downName, name)
+			}
+			gm.downName, gm.down = name, query
+		}
+	}
+
+	sorted := make([]*gmMigration, 0, len(byVersion))
+	for _, gm := range byVersion {
+		if gm.upName == "" {
+			return nil, fmt.Errorf("migration %q has down file %q but no up file", gm.id, gm.downName)
+		}
+		sorted = append(sorted, gm)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].version < sorted[j].version
+	})
+	migrations := make([]SqlxMigration, 0, len(sorted))
+	for _, gm := range sorted {
+		m := SqlxQueryMigration(gm.id, gm.up, gm.down)
+		if gm.downName == "" {
+			m.noRollback = fmt.Sprintf("has up file %q but no down file %q",
+				gm.upName, strings.Replace(gm.upName, ".up.sql", ".down.sql", 1))
+		}
+		migrations = append(migrations, m)
+	}
+	return migrations, nil
+}
+
+// isSQLFile reports whether name is a plain or gzipped SQL file.
+func isSQLFile(name string) bool {
+	return strings.HasSuffix(name, ".sql") || strings.HasSuffix(name, ".sql.gz")
+}
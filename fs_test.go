@@ -0,0 +1,306 @@
+package migrate_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestFSMigrations(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/10_create_widgets.up.sql":    {Data: []byte("CREATE TABLE widgets (id serial PRIMARY KEY);")},
+			"migrations/2_create_users.up.sql":       {Data: []byte(createUsersSql)},
+			"migrations/2_create_users.down.sql":     {Data: []byte(dropUsersSql)},
+			"migrations/001_create_courses.up.sql":   {Data: []byte(createCoursesSql)},
+			"migrations/001_create_courses.down.sql": {Data: []byte(dropCoursesSql)},
+			"migrations/README.md":                   {Data: []byte("ignored")},
+		}
+		migrations, err := migrate.FSMigrations(fsys, "migrations")
+		if err != nil {
+			t.Fatalf("FSMigrations() err = %v; want nil", err)
+		}
+		wantIDs := []string{"001_create_courses", "2_create_users", "10_create_widgets"}
+		if len(migrations) != len(wantIDs) {
+			t.Fatalf("len(migrations) = %d; want %d", len(migrations), len(wantIDs))
+		}
+		for i, id := range wantIDs {
+			if migrations[i].ID != id {
+				t.Errorf("migrations[%d].ID = %q; want %q", i, migrations[i].ID, id)
+			}
+		}
+		if migrations[2].Rollback != nil {
+			t.Errorf("migrations[2].Rollback = non-nil; want nil")
+		}
+
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: migrations,
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "10_create_widgets", "2_create_users")
+	})
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"malformed name": {
+			"migrations/create_users.up.sql": {Data: []byte(createUsersSql)},
+		},
+		"duplicate prefix": {
+			"migrations/001_create_users.up.sql":   {Data: []byte(createUsersSql)},
+			"migrations/001_create_courses.up.sql": {Data: []byte(createCoursesSql)},
+		},
+		"down without up": {
+			"migrations/001_create_users.down.sql": {Data: []byte(dropUsersSql)},
+		},
+		"duplicate up file": {
+			"migrations/001_create_users.up.sql":    {Data: []byte(createUsersSql)},
+			"migrations/001_create_users.up.sql.gz": {Data: []byte("not read")},
+		},
+		"duplicate down file": {
+			"migrations/001_create_users.up.sql":      {Data: []byte(createUsersSql)},
+			"migrations/001_create_users.down.sql":    {Data: []byte(dropUsersSql)},
+			"migrations/001_create_users.down.sql.gz": {Data: []byte("not read")},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := migrate.FSMigrations(fsys, "migrations")
+			if err == nil {
+				t.Fatalf("FSMigrations() err = nil; want error")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+func TestDirMigrations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"1_create_courses.up.sql":   createCoursesSql,
+		"1_create_courses.down.sql": dropCoursesSql,
+		"2_create_users.up.sql":     createUsersSql,
+	}
+	for name, contents := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile() err = %v; want nil", err)
+		}
+	}
+	migrations, err := migrate.DirMigrations(dir)
+	if err != nil {
+		t.Fatalf("DirMigrations() err = %v; want nil", err)
+	}
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: migrations,
+	}
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	assertApplied(t, db, "1_create_courses", "2_create_users")
+
+	_, err = migrate.DirMigrations(filepath.Join(dir, "missing"))
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("DirMigrations() err = %v; want %v", err, fs.ErrNotExist)
+	}
+	_, err = migrate.DirMigrations(filepath.Join(dir, "1_create_courses.up.sql"))
+	if err == nil {
+		t.Errorf("DirMigrations() err = nil; want an error for a file")
+	}
+}
+
+func TestGlobMigrations(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"sql/10_create_widgets.sql":       {Data: []byte("CREATE TABLE widgets (id serial PRIMARY KEY);")},
+			"sql/2_create_users.up.sql":       {Data: []byte(createUsersSql)},
+			"sql/2_create_users.down.sql":     {Data: []byte(dropUsersSql)},
+			"sql/001_create_courses.up.sql":   {Data: []byte(createCoursesSql)},
+			"sql/001_create_courses.down.sql": {Data: []byte(dropCoursesSql)},
+			"sql/README.md":                   {Data: []byte("ignored")},
+			"sql/nested.sql/3_ignored.sql":    {Data: []byte("ignored")},
+		}
+		migrations, err := migrate.GlobMigrations(fsys, "sql/*.sql")
+		if err != nil {
+			t.Fatalf("GlobMigrations() err = %v; want nil", err)
+		}
+		wantIDs := []string{"001_create_courses", "2_create_users", "10_create_widgets"}
+		if len(migrations) != len(wantIDs) {
+			t.Fatalf("len(migrations) = %d; want %d", len(migrations), len(wantIDs))
+		}
+		for i, id := range wantIDs {
+			if migrations[i].ID != id {
+				t.Errorf("migrations[%d].ID = %q; want %q", i, migrations[i].ID, id)
+			}
+		}
+		if migrations[2].Rollback != nil {
+			t.Errorf("migrations[2].Rollback = non-nil; want nil")
+		}
+		if migrations[1].Rollback == nil {
+			t.Errorf("migrations[1].Rollback = nil; want non-nil")
+		}
+
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: migrations,
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "10_create_widgets", "2_create_users")
+	})
+
+	t.Run("duplicate id", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"a/001_create_users.sql":    {Data: []byte(createUsersSql)},
+			"b/001_create_users.up.sql": {Data: []byte(createUsersSql)},
+		}
+		_, err := migrate.GlobMigrations(fsys, "*/*.sql")
+		if !errors.Is(err, migrate.ErrDuplicateID) {
+			t.Fatalf("GlobMigrations() err = %v; want %v", err, migrate.ErrDuplicateID)
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		fsys    fstest.MapFS
+		pattern string
+	}{
+		"down without up": {
+			fsys:    fstest.MapFS{"001_create_users.down.sql": {Data: []byte(dropUsersSql)}},
+			pattern: "*.sql",
+		},
+		"bad pattern": {
+			fsys:    fstest.MapFS{},
+			pattern: "[",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := migrate.GlobMigrations(tc.fsys, tc.pattern)
+			if err == nil {
+				t.Fatalf("GlobMigrations() err = nil; want error")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+func TestGolangMigrateMigrations(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/0001_create_courses.up.sql":   {Data: []byte(createCoursesSql)},
+			"migrations/0001_create_courses.down.sql": {Data: []byte(dropCoursesSql)},
+			"migrations/0010_.up.sql":                 {Data: []byte("CREATE TABLE widgets (id serial PRIMARY KEY);")},
+			"migrations/0002_create_users.up.sql":     {Data: []byte(createUsersSql)},
+			"migrations/0002_create_users.down.sql":   {Data: []byte(dropUsersSql)},
+			"migrations/README.md":                    {Data: []byte("ignored")},
+			"migrations/schema.sql":                   {Data: []byte("ignored")},
+		}
+		migrations, err := migrate.GolangMigrateMigrations(fsys, "migrations")
+		if err != nil {
+			t.Fatalf("GolangMigrateMigrations() err = %v; want nil", err)
+		}
+		wantIDs := []string{"0001_create_courses", "0002_create_users", "0010_"}
+		if len(migrations) != len(wantIDs) {
+			t.Fatalf("len(migrations) = %d; want %d", len(migrations), len(wantIDs))
+		}
+		for i, id := range wantIDs {
+			if migrations[i].ID != id {
+				t.Errorf("migrations[%d].ID = %q; want %q", i, migrations[i].ID, id)
+			}
+		}
+
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: migrations,
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "0001_create_courses", "0002_create_users", "0010_")
+
+		err = migrator.Redo(db, "sqlite3", "0010_")
+		if !errors.Is(err, migrate.ErrNoRollback) {
+			t.Fatalf("Redo() err = %v; want %v", err, migrate.ErrNoRollback)
+		}
+		if !strings.Contains(err.Error(), "0010_.down.sql") {
+			t.Errorf("Redo() err = %v; want it to name the missing down file", err)
+		}
+
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "0010_")
+	})
+
+	t.Run("require rollback", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"migrations/0001_create_courses.up.sql":   {Data: []byte(createCoursesSql)},
+			"migrations/0001_create_courses.down.sql": {Data: []byte(dropCoursesSql)},
+			"migrations/0002_create_users.up.sql":     {Data: []byte(createUsersSql)},
+		}
+		migrations, err := migrate.GolangMigrateMigrations(fsys, "migrations")
+		if err != nil {
+			t.Fatalf("GolangMigrateMigrations() err = %v; want nil", err)
+		}
+		db := sqliteInMem(t)
+		migrator := migrate.NewSqlx(migrations, migrate.WithSilent())
+		migrator.RequireRollback = true
+		err = migrator.Validate()
+		if !errors.Is(err, migrate.ErrNoRollback) {
+			t.Fatalf("Validate() err = %v; want %v", err, migrate.ErrNoRollback)
+		}
+		if !strings.Contains(err.Error(), "0002_create_users.down.sql") {
+			t.Errorf("Validate() err = %v; want it to name the missing down file", err)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrNoRollback) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrNoRollback)
+		}
+	})
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"duplicate version": {
+			"migrations/1_create_users.up.sql":      {Data: []byte(createUsersSql)},
+			"migrations/0001_create_courses.up.sql": {Data: []byte(createCoursesSql)},
+		},
+		"down without up": {
+			"migrations/0001_create_users.down.sql": {Data: []byte(dropUsersSql)},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := migrate.GolangMigrateMigrations(fsys, "migrations")
+			if err == nil {
+				t.Fatalf("GolangMigrateMigrations() err = nil; want error")
+			}
+			t.Log(err)
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MigrationGenerator creates new migration files.
+type MigrationGenerator struct {
+	// Now returns the time used to prefix new migration files. If nil,
+	// time.Now is used.
+	Now func() time.Time
+}
+
+// GenerateMigrationFiles creates empty up and down migration files in dir
+// using the current time. See MigrationGenerator.Generate for details.
+func GenerateMigrationFiles(dir, name string) (upPath, downPath string, err error) {
+	var g MigrationGenerator
+	return g.Generate(dir, name)
+}
+
+// Generate creates YYYYMMDDHHMMSS_name.up.sql and YYYYMMDDHHMMSS_name.down.sql
+// in dir, each containing a header comment, and returns their paths. The
+// timestamp is in UTC. Files are named so that they can be loaded with
+// FSMigrations, and existing files are never overwritten.
+func (g MigrationGenerator) Generate(dir, name string) (upPath, downPath string, err error) {
+	if name == "" {
+		return "", "", errors.New("generating migration: name is empty")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return "", "", fmt.Errorf("generating migration: invalid name: %q", name)
+	}
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+	created := now().UTC()
+	id := created.Format("20060102150405") + "_" + name
+
+	upPath = filepath.Join(dir, id+".up.sql")
+	downPath = filepath.Join(dir, id+".down.sql")
+	header := fmt.Sprintf("-- Migration: %s\n-- Created at: %s\n", id, created.Format(time.RFC3339))
+	err = createFile(upPath, header+"-- Direction: up\n\n")
+	if err != nil {
+		return "", "", err
+	}
+	err = createFile(downPath, header+"-- Direction: down\n\n")
+	if err != nil {
+		os.Remove(upPath)
+		return "", "", err
+	}
+	return upPath, downPath, nil
+}
+
+// createFile writes contents to a new file, failing if it already exists.
+func createFile(path, contents string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("generating migration: %w", err)
+	}
+	_, err = f.WriteString(contents)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("generating migration: %w", err)
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("generating migration: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package migrate_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestMigrationGenerator(t *testing.T) {
+	dir := t.TempDir()
+	g := migrate.MigrationGenerator{
+		Now: func() time.Time {
+			return time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+		},
+	}
+	up, down, err := g.Generate(dir, "create_widgets")
+	if err != nil {
+		t.Fatalf("Generate() err = %v; want nil", err)
+	}
+	if want := filepath.Join(dir, "20240309140507_create_widgets.up.sql"); up != want {
+		t.Errorf("upPath = %q; want %q", up, want)
+	}
+	if want := filepath.Join(dir, "20240309140507_create_widgets.down.sql"); down != want {
+		t.Errorf("downPath = %q; want %q", down, want)
+	}
+	b, err := os.ReadFile(up)
+	if err != nil {
+		t.Fatalf("ReadFile() err = %v; want nil", err)
+	}
+	if !strings.HasPrefix(string(b), "-- Migration: 20240309140507_create_widgets\n") {
+		t.Errorf("up file = %q; want a header comment", b)
+	}
+
+	migrations, err := migrate.FSMigrations(os.DirFS(dir), ".")
+	if err != nil {
+		t.Fatalf("FSMigrations() err = %v; want nil", err)
+	}
+	if len(migrations) != 1 || migrations[0].ID != "20240309140507_create_widgets" {
+		t.Errorf("FSMigrations() = %v; want one migration with ID %q", migrations, "20240309140507_create_widgets")
+	}
+
+	_, _, err = g.Generate(dir, "create_widgets")
+	if !errors.Is(err, os.ErrExist) {
+		t.Errorf("Generate() err = %v; want %v", err, os.ErrExist)
+	}
+	_, _, err = g.Generate(dir, "")
+	if err == nil {
+		t.Errorf("Generate() err = nil; want an error for an empty name")
+	}
+}
@@ -1,9 +1,11 @@
 module github.com/joncalhoun/migrate
 
-go 1.14
+go 1.21
 
 require (
+	github.com/go-sql-driver/mysql v1.4.0
 	github.com/jmoiron/sqlx v1.2.0
 	github.com/mattn/go-sqlite3 v2.0.3+incompatible
-	google.golang.org/appengine v1.6.6 // indirect
 )
+
+require google.golang.org/appengine v1.6.6 // indirect
@@ -0,0 +1,33 @@
+package migrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gzipMagic is the header every gzip stream starts with.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// decodeSQL returns the contents of a migration file as a string,
+// decompressing it first if it is gzipped. A file is treated as gzipped if
+// its name ends in ".gz" or its contents start with the gzip magic bytes, so
+// compressed files work with every file-based loader without any extra
+// configuration.
+func decodeSQL(name string, b []byte) (string, error) {
+	if !strings.HasSuffix(name, ".gz") && !bytes.HasPrefix(b, gzipMagic) {
+		return string(b), nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return "", fmt.Errorf("decompressing migration file %q: %w", name, err)
+	}
+	defer zr.Close()
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("decompressing migration file %q: %w", name, err)
+	}
+	return string(decoded), nil
+}
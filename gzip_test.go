@@ -0,0 +1,138 @@
+package migrate_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joncalhoun/migrate"
+)
+
+func TestGzipMigrations(t *testing.T) {
+	seed := func(t *testing.T, m migrate.SqlxMigration) []string {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				m,
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		var names []string
+		err = sqlx.NewDb(db, "sqlite3").Select(&names, "SELECT name FROM courses ORDER BY id")
+		if err != nil {
+			t.Fatalf("db.Select() err = %v; want nil", err)
+		}
+		return names
+	}
+
+	t.Run("file", func(t *testing.T) {
+		plain := migrate.SqlxFileMigration("002_seed_courses", "testdata/seed.sql", "", migrate.WithStatementSplitting(true))
+		gzipped := migrate.SqlxFileMigration("002_seed_courses", "testdata/seed.sql.gz", "", migrate.WithStatementSplitting(true))
+		if gzipped.UpQuery != plain.UpQuery {
+			t.Fatalf("UpQuery = %q; want %q", gzipped.UpQuery, plain.UpQuery)
+		}
+		var want, got []string
+		t.Run("plain", func(t *testing.T) { want = seed(t, plain) })
+		t.Run("gzipped", func(t *testing.T) { got = seed(t, gzipped) })
+		if len(want) == 0 {
+			t.Fatalf("plain migration seeded no courses")
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("names = %q; want %q", got, want)
+		}
+	})
+
+	t.Run("fs", func(t *testing.T) {
+		gzipped, err := os.ReadFile("testdata/seed.sql.gz")
+		if err != nil {
+			t.Fatalf("ReadFile() err = %v; want nil", err)
+		}
+		fsys := fstest.MapFS{
+			"migrations/001_create_courses.up.sql":    {Data: []byte(createCoursesSql)},
+			"migrations/002_seed_courses.up.sql.gz":   {Data: gzipped},
+			"migrations/002_seed_courses.down.sql.gz": {Data: gzipBytes(t, "DELETE FROM courses;")},
+		}
+		for name, load := range map[string]func() ([]migrate.SqlxMigration, error){
+			"FSMigrations": func() ([]migrate.SqlxMigration, error) {
+				return migrate.FSMigrations(fsys, "migrations")
+			},
+			"GlobMigrations": func() ([]migrate.SqlxMigration, error) {
+				return migrate.GlobMigrations(fsys, "migrations/*")
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				migrations, err := load()
+				if err != nil {
+					t.Fatalf("%s() err = %v; want nil", name, err)
+				}
+				if len(migrations) != 2 {
+					t.Fatalf("len(migrations) = %d; want 2", len(migrations))
+				}
+				if migrations[1].ID != "002_seed_courses" {
+					t.Errorf("migrations[1].ID = %q; want %q", migrations[1].ID, "002_seed_courses")
+				}
+				if migrations[1].DownQuery != "DELETE FROM courses;" {
+					t.Errorf("migrations[1].DownQuery = %q; want %q", migrations[1].DownQuery, "DELETE FROM courses;")
+				}
+				// The seed file has several statements, which sqlite runs in a
+				// single Exec just as it would for the plaintext file.
+				got := seed(t, migrations[1])
+				want := []string{"semi;colon", "it's; quoted", "double;quoted"}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("names = %q; want %q", got, want)
+				}
+			})
+		}
+	})
+
+	t.Run("magic bytes", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"001_create_courses.sql": {Data: gzipBytes(t, createCoursesSql)},
+		}
+		migrations, err := migrate.GlobMigrations(fsys, "*.sql")
+		if err != nil {
+			t.Fatalf("GlobMigrations() err = %v; want nil", err)
+		}
+		if migrations[0].UpQuery != createCoursesSql {
+			t.Errorf("UpQuery = %q; want %q", migrations[0].UpQuery, createCoursesSql)
+		}
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"001_create_courses.up.sql.gz": {Data: []byte(createCoursesSql)},
+		}
+		_, err := migrate.FSMigrations(fsys, ".")
+		if err == nil {
+			t.Fatalf("FSMigrations() err = nil; want error")
+		}
+		t.Log(err)
+	})
+}
+
+func gzipBytes(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	if err != nil {
+		t.Fatalf("gzip Write() err = %v; want nil", err)
+	}
+	err = zw.Close()
+	if err != nil {
+		t.Fatalf("gzip Close() err = %v; want nil", err)
+	}
+	return buf.Bytes()
+}
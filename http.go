@@ -0,0 +1,111 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// HTTPManifest lists the migration files HTTPMigrations downloads. It is
+// fetched as JSON from manifest.json under the base URL, such as:
+//
+//	{
+//	  "files": [
+//	    {"name": "001_create_users.up.sql", "sha256": "9f86d08..."},
+//	    {"name": "001_create_users.down.sql", "sha256": "60303ae..."}
+//	  ]
+//	}
+type HTTPManifest struct {
+	Files []HTTPManifestFile `json:"files"`
+}
+
+// HTTPManifestFile is a single file listed in an HTTPManifest.
+type HTTPManifestFile struct {
+	// Name is the file's name, relative to the base URL. It must follow the
+	// naming rules of FSMigrations and may not contain a slash.
+	Name string `json:"name"`
+	// SHA256 is the hex encoded SHA-256 checksum of the file as it is
+	// served. If set, the downloaded file must match it.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// HTTPMigrations will create a SqlxMigration for each pair of SQL files
+// listed in the manifest.json found at baseURL, downloading each file from
+// baseURL. Files follow the same naming rules as FSMigrations, and any file
+// with a SHA256 in the manifest is checked against it so that a file that
+// was tampered with or truncated in transit is rejected rather than run.
+//
+// Requests are made with client, which can be configured with a Timeout and
+// a Transport that adds authentication. If client is nil http.DefaultClient
+// is used, which has no timeout, so ctx should have a deadline. Any response
+// other than 200 OK is an error.
+func HTTPMigrations(ctx context.Context, client *http.Client, baseURL string) ([]SqlxMigration, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	get := func(name string) ([]byte, error) {
+		u, err := url.JoinPath(baseURL, name)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %q: %w", name, err)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %q: %w", u, err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %q: %w", u, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("fetching %q: unexpected status %s", u, resp.Status)
+		}
+		b, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("fetching %q: %w", u, err)
+		}
+		return b, nil
+	}
+
+	b, err := get("manifest.json")
+	if err != nil {
+		return nil, err
+	}
+	var manifest HTTPManifest
+	err = json.Unmarshal(b, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("decoding migrations manifest: %w", err)
+	}
+	sums := make(map[string]string, len(manifest.Files))
+	names := make([]string, 0, len(manifest.Files))
+	for _, f := range manifest.Files {
+		if f.Name == "" || path.Base(f.Name) != f.Name || f.Name == ".." {
+			return nil, fmt.Errorf("invalid migration file name in manifest: %q", f.Name)
+		}
+		if _, ok := sums[f.Name]; ok {
+			return nil, fmt.Errorf("duplicate migration file in manifest: %q", f.Name)
+		}
+		sums[f.Name] = strings.ToLower(f.SHA256)
+		names = append(names, f.Name)
+	}
+	return numberedMigrations(names, func(name string) ([]byte, error) {
+		b, err := get(name)
+		if err != nil {
+			return nil, err
+		}
+		if want := sums[name]; want != "" {
+			sum := sha256.Sum256(b)
+			if got := hex.EncodeToString(sum[:]); got != want {
+				return nil, fmt.Errorf("migration file %q has sha256 %s; manifest wants %s", name, got, want)
+			}
+		}
+		return b, nil
+	})
+}
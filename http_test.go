@@ -0,0 +1,132 @@
+package migrate_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestHTTPMigrations(t *testing.T) {
+	sum := func(s string) string {
+		b := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(b[:])
+	}
+	files := map[string]string{
+		"001_create_courses.up.sql":   createCoursesSql,
+		"001_create_courses.down.sql": dropCoursesSql,
+		"2_create_users.up.sql":       createUsersSql,
+	}
+	serve := func(t *testing.T, manifest migrate.HTTPManifest, served map[string]string) string {
+		t.Helper()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/migrations/", func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			name := strings.TrimPrefix(r.URL.Path, "/migrations/")
+			if name == "manifest.json" {
+				json.NewEncoder(w).Encode(manifest)
+				return
+			}
+			contents, ok := served[name]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(contents))
+		})
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+		return srv.URL + "/migrations"
+	}
+	client := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: bearerTransport{"secret"},
+	}
+	manifest := migrate.HTTPManifest{Files: []migrate.HTTPManifestFile{
+		{Name: "2_create_users.up.sql", SHA256: sum(createUsersSql)},
+		{Name: "001_create_courses.up.sql", SHA256: sum(createCoursesSql)},
+		{Name: "001_create_courses.down.sql"},
+	}}
+
+	t.Run("valid", func(t *testing.T) {
+		baseURL := serve(t, manifest, files)
+		migrations, err := migrate.HTTPMigrations(context.Background(), client, baseURL)
+		if err != nil {
+			t.Fatalf("HTTPMigrations() err = %v; want nil", err)
+		}
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: migrations,
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "2_create_users")
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := map[string]string{}
+		for name, contents := range files {
+			tampered[name] = contents
+		}
+		tampered["2_create_users.up.sql"] = createUsersSql + " DROP TABLE courses;"
+		baseURL := serve(t, manifest, tampered)
+		_, err := migrate.HTTPMigrations(context.Background(), client, baseURL)
+		if err == nil || !strings.Contains(err.Error(), "sha256") {
+			t.Fatalf("HTTPMigrations() err = %v; want a checksum error", err)
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		manifest migrate.HTTPManifest
+		client   *http.Client
+	}{
+		"missing file": {
+			manifest: migrate.HTTPManifest{Files: []migrate.HTTPManifestFile{{Name: "3_missing.up.sql"}}},
+			client:   client,
+		},
+		"unauthorized": {
+			manifest: manifest,
+			client:   nil,
+		},
+		"path in name": {
+			manifest: migrate.HTTPManifest{Files: []migrate.HTTPManifestFile{{Name: "../001_create_courses.up.sql"}}},
+			client:   client,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			baseURL := serve(t, tc.manifest, files)
+			_, err := migrate.HTTPMigrations(context.Background(), tc.client, baseURL)
+			if err == nil {
+				t.Fatalf("HTTPMigrations() err = nil; want error")
+			}
+			t.Log(err)
+		})
+	}
+}
+
+// bearerTransport adds an Authorization header to every request.
+type bearerTransport struct {
+	token string
+}
+
+func (bt bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+bt.token)
+	return http.DefaultTransport.RoundTrip(r)
+}
@@ -0,0 +1,179 @@
+package migrate
+
+import "strings"
+
+// sqlRules describe the quoting and comment syntax of a dialect. They are
+// shared by StripComments and splitStatements so that both agree on where
+// quoted sections and comments start and end.
+type sqlRules struct {
+	// backticks and brackets enable `ident` and [ident] quoted identifiers.
+	backticks, brackets bool
+	// dollarQuotes enables Postgres dollar-quoted strings like $tag$...$tag$.
+	dollarQuotes bool
+	// backslashEscapes treats a backslash inside '...' and "..." as escaping
+	// the following character. Postgres only does so for E'...' strings, which
+	// are always recognized when dollarQuotes is enabled.
+	backslashEscapes bool
+	// nestedComments allows block comments to nest, as in /* a /* b */ c */.
+	nestedComments bool
+	// hashComments enables # line comments. It also means -- only starts a
+	// comment when followed by whitespace, and that /*! ... */ executable
+	// comments are treated as SQL rather than comments.
+	hashComments bool
+}
+
+// sqlRulesFor returns the rules to use for dialect.
+func sqlRulesFor(dialect string) sqlRules {
+	switch {
+	case dialect == "mysql":
+		return sqlRules{backticks: true, backslashEscapes: true, hashComments: true}
+	case dialect == "sqlserver":
+		return sqlRules{brackets: true, nestedComments: true}
+	case dialect == "sqlite3":
+		return sqlRules{backticks: true, brackets: true}
+	case postgresDialects[dialect]:
+		return sqlRules{dollarQuotes: true, nestedComments: true}
+	}
+	return sqlRules{backticks: true, dollarQuotes: true}
+}
+
+// tokenKind is the kind of token returned by nextToken.
+type tokenKind int
+
+const (
+	// tokenOther is a single byte of SQL outside of any quotes or comments,
+	// or a MySQL executable comment.
+	tokenOther tokenKind = iota
+	// tokenQuoted is a quoted string, quoted identifier, or dollar-quoted
+	// string, including its quotes.
+	tokenQuoted
+	// tokenLineComment is a line comment, up to but not including the
+	// newline that ends it.
+	tokenLineComment
+	// tokenBlockComment is a block comment, including its delimiters.
+	tokenBlockComment
+)
+
+// nextToken returns the kind of the token starting at sql[i] along with the
+// index just past its end. Unterminated quotes and block comments run to the
+// end of sql.
+func (r sqlRules) nextToken(sql string, i int) (tokenKind, int) {
+	c := sql[i]
+	next := byte(0)
+	if i+1 < len(sql) {
+		next = sql[i+1]
+	}
+	switch {
+	case c == '\'' || c == '"':
+		backslash := r.backslashEscapes || (c == '\'' && r.dollarQuotes && isEscapeString(sql, i))
+		return tokenQuoted, quotedEnd(sql, i+1, c, backslash)
+	case c == '`' && r.backticks:
+		return tokenQuoted, quotedEnd(sql, i+1, '`', false)
+	case c == '[' && r.brackets:
+		return tokenQuoted, quotedEnd(sql, i+1, ']', false)
+	case c == '$' && r.dollarQuotes && (i == 0 || !isIdentChar(sql[i-1])):
+		tag, ok := dollarQuoteTag(sql[i:])
+		if !ok {
+			return tokenOther, i + 1
+		}
+		j := strings.Index(sql[i+len(tag):], tag)
+		if j < 0 {
+			return tokenQuoted, len(sql)
+		}
+		return tokenQuoted, i + len(tag) + j + len(tag)
+	case c == '-' && next == '-' && (!r.hashComments || i+2 == len(sql) || sql[i+2] <= ' '),
+		c == '#' && r.hashComments:
+		return tokenLineComment, lineCommentEnd(sql, i)
+	case c == '/' && next == '*':
+		end := blockCommentEnd(sql, i, r.nestedComments)
+		if r.hashComments && strings.HasPrefix(sql[i:], "/*!") {
+			return tokenOther, end
+		}
+		return tokenBlockComment, end
+	}
+	return tokenOther, i + 1
+}
+
+// quotedEnd returns the index just past the close byte that ends a quoted
+// section whose contents start at i, or len(sql) if it isn't closed. A
+// doubled close byte is an escaped one rather than the end of the section.
+func quotedEnd(sql string, i int, close byte, backslash bool) int {
+	for ; i < len(sql); i++ {
+		switch {
+		case backslash && sql[i] == '\\':
+			i++
+		case sql[i] == close && i+1 < len(sql) && sql[i+1] == close:
+			i++
+		case sql[i] == close:
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// lineCommentEnd returns the index of the newline ending the line comment
+// starting at i, or len(sql) if there isn't one.
+func lineCommentEnd(sql string, i int) int {
+	j := strings.IndexByte(sql[i:], '\n')
+	if j < 0 {
+		return len(sql)
+	}
+	return i + j
+}
+
+// blockCommentEnd returns the index just past the end of the block comment
+// starting at i, or len(sql) if it isn't closed.
+func blockCommentEnd(sql string, i int, nested bool) int {
+	depth := 0
+	for i < len(sql)-1 {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			if depth == 0 || nested {
+				depth++
+			}
+			i += 2
+		case sql[i] == '*' && sql[i+1] == '/':
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+	return len(sql)
+}
+
+// dollarQuoteTag returns the opening tag of a Postgres dollar-quoted string,
+// such as $$ or $body$, if s starts with one. Tags follow the same rules as
+// unquoted identifiers, so positional parameters like $1 aren't mistaken for
+// one.
+func dollarQuoteTag(s string) (string, bool) {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1], true
+		case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case isDigit(c) && i > 1:
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// isEscapeString reports whether the quote at sql[i] opens a Postgres E'...'
+// string, which allows backslash escapes.
+func isEscapeString(sql string, i int) bool {
+	if i == 0 || (sql[i-1] != 'E' && sql[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentChar(sql[i-2])
+}
+
+// isIdentChar reports whether c can appear in an unquoted identifier.
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,229 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Locker is used to prevent multiple processes from running migrations
+// against the same database at the same time. Lock should block until the
+// lock is acquired or the context is done.
+type Locker interface {
+	Lock(ctx context.Context, db *sqlx.DB) error
+	Unlock(ctx context.Context, db *sqlx.DB) error
+}
+
+// DefaultAdvisoryLockKey is the advisory lock key used when AdvisoryLock is
+// enabled but AdvisoryLockKey isn't set.
+const DefaultAdvisoryLockKey int64 = 0x6d696772617465 // "migrate" in ASCII
+
+// postgresDialects are the dialects that support pg_advisory_lock.
+var postgresDialects = map[string]bool{
+	"postgres":         true,
+	"pgx":              true,
+	"pq-timeouts":      true,
+	"cloudsqlpostgres": true,
+}
+
+// lock acquires a lock using the configured Locker, if any, returning a
+// function that releases it. When no lock is needed the returned function
+// does nothing.
+func (s *Sqlx) lock(ctx context.Context, db *sqlx.DB) (func() error, error) {
+	locker := s.Locker
+	if locker == nil && s.AdvisoryLock && postgresDialects[db.DriverName()] {
+		locker = &PostgresLocker{Key: s.AdvisoryLockKey}
+	}
+	if locker == nil {
+		return func() error { return nil }, nil
+	}
+
+	s.log(LevelInfo, "Acquiring migration lock...")
+	err := locker.Lock(ctx, db)
+	if err != nil {
+		return nil, fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	return func() error {
+		err := locker.Unlock(context.Background(), db)
+		if err != nil {
+			return fmt.Errorf("releasing migration lock: %w", err)
+		}
+		return nil
+	}, nil
+}
+
+// PostgresLocker is a Locker that uses a Postgres session level advisory
+// lock. A PostgresLocker holds onto a single connection between Lock and
+// Unlock, so it should not be shared between migrators running concurrently.
+type PostgresLocker struct {
+	// Key is the key passed to pg_advisory_lock. If zero,
+	// DefaultAdvisoryLockKey is used.
+	Key int64
+
+	conn *sql.Conn
+}
+
+// Lock implements Locker.
+func (l *PostgresLocker) Lock(ctx context.Context, db *sqlx.DB) error {
+	// Advisory locks belong to a session, so we need to lock and unlock using
+	// the same connection rather than whichever one the pool hands us.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", l.key())
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	l.conn = conn
+	return nil
+}
+
+// Unlock implements Locker.
+func (l *PostgresLocker) Unlock(ctx context.Context, db *sqlx.DB) error {
+	if l.conn == nil {
+		return errors.New("not locked")
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+	_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key())
+	return err
+}
+
+func (l *PostgresLocker) key() int64 {
+	if l.Key == 0 {
+		return DefaultAdvisoryLockKey
+	}
+	return l.Key
+}
+
+// MySQLLocker is a Locker that uses MySQL's GET_LOCK and RELEASE_LOCK. Like
+// PostgresLocker, it holds onto a single connection between Lock and Unlock.
+type MySQLLocker struct {
+	// Name is the name of the lock. If empty, "migrate" is used.
+	Name string
+	// Timeout is how long to wait for the lock. If zero, Lock will wait
+	// indefinitely.
+	Timeout time.Duration
+
+	conn *sql.Conn
+}
+
+// Lock implements Locker.
+func (l *MySQLLocker) Lock(ctx context.Context, db *sqlx.DB) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	timeout := -1
+	if l.Timeout > 0 {
+		// GET_LOCK takes whole seconds, and a timeout of 0 doesn't wait at
+		// all, so round up rather than truncating sub-second timeouts.
+		timeout = int((l.Timeout + time.Second - 1) / time.Second)
+	}
+	var got sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", l.name(), timeout).Scan(&got)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		conn.Close()
+		return fmt.Errorf("timed out waiting for lock %q", l.name())
+	}
+	l.conn = conn
+	return nil
+}
+
+// Unlock implements Locker.
+func (l *MySQLLocker) Unlock(ctx context.Context, db *sqlx.DB) error {
+	if l.conn == nil {
+		return errors.New("not locked")
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+	_, err := l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.name())
+	return err
+}
+
+func (l *MySQLLocker) name() string {
+	if l.Name == "" {
+		return "migrate"
+	}
+	return l.Name
+}
+
+// TableLocker is a Locker that works with any database by inserting a row
+// into a lock table, relying on the table's primary key to ensure only one
+// process holds the lock at a time. It is primarily intended for databases
+// like SQLite that don't have a native locking primitive.
+//
+// Note: If a process dies while holding the lock the row is left behind and
+// must be deleted by hand before migrations can run again.
+type TableLocker struct {
+	// TableName is the name of the lock table. If empty, "migration_locks" is
+	// used. It is subject to the same restrictions as Sqlx.TableName.
+	TableName string
+	// PollInterval is how long to wait between attempts to acquire the lock.
+	// If zero, one second is used.
+	PollInterval time.Duration
+}
+
+// Lock implements Locker.
+func (l *TableLocker) Lock(ctx context.Context, db *sqlx.DB) error {
+	table, err := l.tableName()
+	if err != nil {
+		return err
+	}
+	types := columnTypesFor(db.DriverName())
+	_, err = db.ExecContext(ctx, createTableSQL(db.DriverName(), table, "id "+types.key+" PRIMARY KEY, locked_at "+types.timestamp))
+	if err != nil && !isAlreadyExists(err) {
+		return fmt.Errorf("creating lock table: %w", err)
+	}
+	interval := l.PollInterval
+	if interval == 0 {
+		interval = time.Second
+	}
+	for {
+		_, err = db.ExecContext(ctx, db.Rebind("INSERT INTO "+table+" (id, locked_at) VALUES (?, ?)"), "lock", time.Now().UTC())
+		if err == nil {
+			return nil
+		}
+		// We can't portably tell a primary key violation apart from other
+		// errors, so we keep trying until the context gives up on us.
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: last error: %v", ctx.Err(), err)
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Unlock implements Locker.
+func (l *TableLocker) Unlock(ctx context.Context, db *sqlx.DB) error {
+	table, err := l.tableName()
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, db.Rebind("DELETE FROM "+table+" WHERE id=?"), "lock")
+	return err
+}
+
+func (l *TableLocker) tableName() (string, error) {
+	if l.TableName == "" {
+		return "migration_locks", nil
+	}
+	if !validTableName.MatchString(l.TableName) {
+		return "", fmt.Errorf("invalid lock table name: %q", l.TableName)
+	}
+	return l.TableName, nil
+}
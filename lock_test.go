@@ -0,0 +1,206 @@
+package migrate_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSqlx_AdvisoryLock(t *testing.T) {
+	// pg_advisory_lock isn't available outside of Postgres, so for any other
+	// dialect the lock should quietly be skipped.
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		},
+		AdvisoryLock: true,
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	err = migrator.Rollback(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Rollback() err = %v; want nil", err)
+	}
+}
+
+func TestTableLocker(t *testing.T) {
+	db := sqlx.NewDb(sqliteInMem(t), "sqlite3")
+	first := &migrate.TableLocker{PollInterval: time.Millisecond}
+	second := &migrate.TableLocker{PollInterval: time.Millisecond}
+
+	err := first.Lock(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Lock() err = %v; want nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = second.Lock(ctx, db)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock() err = %v; want %v", err, context.DeadlineExceeded)
+	}
+	err = first.Unlock(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Unlock() err = %v; want nil", err)
+	}
+	err = second.Lock(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Lock() err = %v; want nil", err)
+	}
+	err = second.Unlock(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Unlock() err = %v; want nil", err)
+	}
+}
+
+type recordingLocker struct {
+	calls []string
+}
+
+func (l *recordingLocker) Lock(ctx context.Context, db *sqlx.DB) error {
+	l.calls = append(l.calls, "lock")
+	return nil
+}
+
+func (l *recordingLocker) Unlock(ctx context.Context, db *sqlx.DB) error {
+	l.calls = append(l.calls, "unlock")
+	return nil
+}
+
+func TestSqlx_Locker(t *testing.T) {
+	db := sqliteInMem(t)
+	locker := &recordingLocker{}
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			{
+				ID: "001_check_lock",
+				Migrate: func(tx *sqlx.Tx) error {
+					locker.calls = append(locker.calls, "migrate")
+					return nil
+				},
+			},
+		},
+		Locker: locker,
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	want := []string{"lock", "migrate", "unlock"}
+	if fmt.Sprint(locker.calls) != fmt.Sprint(want) {
+		t.Fatalf("calls = %v; want %v", locker.calls, want)
+	}
+}
+
+// racingLocker runs another migrator before granting the lock, as though
+// another instance had held the lock and applied the migrations first.
+type racingLocker struct {
+	recordingLocker
+	other func() error
+}
+
+func (l *racingLocker) Lock(ctx context.Context, db *sqlx.DB) error {
+	err := l.other()
+	if err != nil {
+		return err
+	}
+	return l.recordingLocker.Lock(ctx, db)
+}
+
+func TestSqlx_AutoMigrate(t *testing.T) {
+	migrations := []migrate.SqlxMigration{
+		migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+	}
+
+	t.Run("runs pending", func(t *testing.T) {
+		db := sqliteInMem(t)
+		locker := &recordingLocker{}
+		migrator := migrate.Sqlx{Logger: &recordingLogger{}, Migrations: migrations, Locker: locker}
+		err := migrator.AutoMigrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("AutoMigrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+		if want := []string{"lock", "unlock"}; fmt.Sprint(locker.calls) != fmt.Sprint(want) {
+			t.Errorf("calls = %v; want %v", locker.calls, want)
+		}
+
+		// Once up to date the lock isn't needed.
+		locker.calls = nil
+		err = migrator.AutoMigrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("AutoMigrate() err = %v; want nil", err)
+		}
+		if len(locker.calls) != 0 {
+			t.Errorf("calls = %v; want none", locker.calls)
+		}
+	})
+
+	t.Run("lost the race", func(t *testing.T) {
+		db := sqliteInMem(t)
+		logger := &recordingLogger{}
+		other := migrate.Sqlx{Logger: &recordingLogger{}, Migrations: migrations}
+		locker := &racingLocker{other: func() error { return other.Migrate(db, "sqlite3") }}
+		migrator := migrate.Sqlx{Logger: logger, Migrations: migrations, Locker: locker}
+		err := migrator.AutoMigrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("AutoMigrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+		found := false
+		for _, e := range logger.entries {
+			found = found || e.msg == "Another process applied 2 of 2 pending migrations while waiting for the lock"
+		}
+		if !found {
+			t.Errorf("entries = %v; want a message saying another process applied the migrations", logger.entries)
+		}
+	})
+}
+
+func TestMySQLLocker_timeout(t *testing.T) {
+	tests := map[string]struct {
+		timeout time.Duration
+		want    int64
+	}{
+		"unset":       {0, -1},
+		"sub-second":  {500 * time.Millisecond, 1},
+		"whole":       {2 * time.Second, 2},
+		"fractional":  {2500 * time.Millisecond, 3},
+		"nanoseconds": {time.Nanosecond, 1},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db, fdb := openFake(t)
+			locker := &migrate.MySQLLocker{Timeout: tc.timeout}
+			xdb := sqlx.NewDb(db, "mysql")
+			err := locker.Lock(context.Background(), xdb)
+			if err != nil {
+				t.Fatalf("Lock() err = %v; want nil", err)
+			}
+			err = locker.Unlock(context.Background(), xdb)
+			if err != nil {
+				t.Fatalf("Unlock() err = %v; want nil", err)
+			}
+			got := fdb.LockTimeouts()
+			if len(got) != 1 || got[0] != tc.want {
+				t.Errorf("GET_LOCK timeouts = %v; want [%d]", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Level is the severity of a log message.
+type Level int
+
+// Levels used by the migrator.
+const (
+	LevelInfo Level = iota
+	LevelError
+)
+
+// Field is a key/value pair attached to a log message, such as the ID of the
+// migration the message is about.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is used to report progress during a migration. msg is a complete,
+// human readable message, and fields contain the same information in a
+// structured form for loggers that support it.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// PrintfLogger returns a Logger that writes each message on its own line
+// using the provided printf function, ignoring the structured fields. If
+// printf is nil, fmt.Printf is used.
+func PrintfLogger(printf func(format string, a ...interface{}) (n int, err error)) Logger {
+	if printf == nil {
+		printf = fmt.Printf
+	}
+	return printfLogger(printf)
+}
+
+// DiscardPrintf is a printf function that ignores its inputs. Assign it to
+// Sqlx.Printf to silence progress output:
+//
+//	migrator := migrate.Sqlx{
+//		Printf:     migrate.DiscardPrintf,
+//		Migrations: migrations,
+//	}
+func DiscardPrintf(format string, a ...interface{}) (n int, err error) {
+	return 0, nil
+}
+
+type printfLogger func(format string, a ...interface{}) (n int, err error)
+
+func (p printfLogger) Log(level Level, msg string, fields ...Field) {
+	p("%s\n", msg)
+}
+
+// SlogLogger returns a Logger that writes to the provided *slog.Logger,
+// passing fields along as attributes.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Log(level Level, msg string, fields ...Field) {
+	slogLevel := slog.LevelInfo
+	if level == LevelError {
+		slogLevel = slog.LevelError
+	}
+	attrs := make([]slog.Attr, 0, len(fields))
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	s.l.LogAttrs(context.Background(), slogLevel, msg, attrs...)
+}
+
+// log writes a message to the configured Logger, falling back to Printf.
+func (s *Sqlx) log(level Level, msg string, fields ...Field) {
+	logger := s.Logger
+	if logger == nil {
+		logger = PrintfLogger(s.Printf)
+	}
+	logger.Log(level, msg, fields...)
+}
@@ -0,0 +1,119 @@
+package migrate_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+type logEntry struct {
+	level  migrate.Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (l *recordingLogger) Log(level migrate.Level, msg string, fields ...migrate.Field) {
+	e := logEntry{level: level, msg: msg, fields: make(map[string]interface{})}
+	for _, f := range fields {
+		e.fields[f.Key] = f.Value
+	}
+	l.entries = append(l.entries, e)
+}
+
+func TestSqlx_Logger(t *testing.T) {
+	db := sqliteInMem(t)
+	logger := &recordingLogger{}
+	migrator := migrate.Sqlx{
+		Logger: logger,
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Errorf("Printf() called; want Logger to be used instead")
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, ""),
+			migrate.SqlxQueryMigration("002_broken", "NOT VALID SQL", ""),
+		},
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err == nil {
+		t.Fatalf("Migrate() err = nil; want error")
+	}
+
+	var running, failed bool
+	for _, e := range logger.entries {
+		if e.fields["id"] == "001_create_courses" && e.fields["outcome"] == "running" {
+			running = true
+		}
+		if e.fields["id"] == "002_broken" && e.fields["outcome"] == "failed" {
+			failed = true
+			if e.level != migrate.LevelError {
+				t.Errorf("level = %v; want %v", e.level, migrate.LevelError)
+			}
+			if e.fields["error"] == nil {
+				t.Errorf("error field = nil; want the migration error")
+			}
+		}
+	}
+	if !running || !failed {
+		t.Fatalf("entries = %+v; want a running entry for 001 and a failed entry for 002", logger.entries)
+	}
+}
+
+func TestPrintfLogger(t *testing.T) {
+	var out strings.Builder
+	logger := migrate.PrintfLogger(func(format string, args ...interface{}) (int, error) {
+		return fmt.Fprintf(&out, format, args...)
+	})
+	logger.Log(migrate.LevelInfo, "Running migration: 001_create_courses", migrate.Field{Key: "id", Value: "001_create_courses"})
+	if got, want := out.String(), "Running migration: 001_create_courses\n"; got != want {
+		t.Fatalf("output = %q; want %q", got, want)
+	}
+}
+
+func TestDiscardPrintf(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: migrate.DiscardPrintf,
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		},
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	n, err := migrate.DiscardPrintf("%s\n", "ignored")
+	if n != 0 || err != nil {
+		t.Errorf("DiscardPrintf() = %d, %v; want 0, nil", n, err)
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := migrate.SlogLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	logger.Log(migrate.LevelError, "Migration failed: 001_create_courses", migrate.Field{Key: "id", Value: "001_create_courses"})
+
+	var got map[string]interface{}
+	err := json.Unmarshal(buf.Bytes(), &got)
+	if err != nil {
+		t.Fatalf("json.Unmarshal() err = %v; want nil", err)
+	}
+	if got["level"] != "ERROR" {
+		t.Errorf("level = %v; want %v", got["level"], "ERROR")
+	}
+	if got["msg"] != "Migration failed: 001_create_courses" {
+		t.Errorf("msg = %v; want %v", got["msg"], "Migration failed: 001_create_courses")
+	}
+	if got["id"] != "001_create_courses" {
+		t.Errorf("id = %v; want %v", got["id"], "001_create_courses")
+	}
+}
@@ -0,0 +1,76 @@
+// Package migratetest provides helpers for testing migrations written with
+// github.com/joncalhoun/migrate.
+package migratetest
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+// ResetDB rolls back every migration applied to db and then runs every
+// migration in migrator again, so that each subtest can start from a freshly
+// migrated database. Unlike migrator.Reset it doesn't require AllowReset to
+// be set, and migrator isn't modified. The test fails immediately if either
+// step returns an error.
+func ResetDB(t testing.TB, db *sql.DB, dialect string, migrator *migrate.Sqlx) {
+	t.Helper()
+	m := *migrator
+	m.AllowReset = true
+	err := m.Reset(db, dialect)
+	if err != nil {
+		t.Fatalf("migratetest.ResetDB() err = %v; want nil", err)
+	}
+}
+
+// AssertApplied fails the test immediately unless exactly the migrations with
+// the provided IDs are recorded as applied in the default migrations table of
+// db, in any order. The failure message lists the IDs that are missing and
+// those that are unexpected.
+func AssertApplied(t testing.TB, db *sql.DB, dialect string, ids ...string) {
+	t.Helper()
+	// With no migrations configured every applied migration is reported as
+	// orphaned, so Status lists exactly what has been recorded.
+	statuses, err := migrate.NewSqlx(nil, migrate.WithSilent()).Status(db, dialect)
+	if err != nil {
+		t.Fatalf("migratetest.AssertApplied() err = %v; want nil", err)
+		return
+	}
+	got := make(map[string]bool, len(statuses))
+	var gotIDs []string
+	for _, st := range statuses {
+		got[st.ID] = true
+		gotIDs = append(gotIDs, st.ID)
+	}
+	want := make(map[string]bool, len(ids))
+	var missing, unexpected []string
+	for _, id := range ids {
+		want[id] = true
+		if !got[id] {
+			missing = append(missing, id)
+		}
+	}
+	for _, id := range gotIDs {
+		if !want[id] {
+			unexpected = append(unexpected, id)
+		}
+	}
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return
+	}
+	sort.Slice(missing, func(i, j int) bool {
+		return migrate.CompareIDs(missing[i], missing[j]) < 0
+	})
+	var b strings.Builder
+	b.WriteString("applied migrations don't match:")
+	for _, id := range missing {
+		b.WriteString("\n  - " + id + " (not applied)")
+	}
+	for _, id := range unexpected {
+		b.WriteString("\n  + " + id + " (unexpectedly applied)")
+	}
+	t.Fatalf("%s", b.String())
+}
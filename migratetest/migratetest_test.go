@@ -0,0 +1,88 @@
+package migratetest_test
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+	"github.com/joncalhoun/migrate/migratetest"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func sqliteInMem(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatalf("Open() err = %v; want nil", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// fatalRecorder records calls to Fatalf rather than stopping the test.
+type fatalRecorder struct {
+	testing.TB
+	msgs []string
+}
+
+func (fr *fatalRecorder) Helper() {}
+
+func (fr *fatalRecorder) Fatalf(format string, args ...interface{}) {
+	fr.msgs = append(fr.msgs, fmt.Sprintf(format, args...))
+}
+
+func TestResetDB(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.NewSqlx([]migrate.SqlxMigration{
+		migrate.SqlxQueryMigration("001_create_courses", "CREATE TABLE courses (id int, name text);", "DROP TABLE courses;"),
+		migrate.SqlxQueryMigration("002_create_users", "CREATE TABLE users (id int);", "DROP TABLE users;"),
+	}, migrate.WithSilent())
+	migratetest.ResetDB(t, db, "sqlite3", migrator)
+	migratetest.AssertApplied(t, db, "sqlite3", "001_create_courses", "002_create_users")
+
+	_, err := db.Exec("INSERT INTO courses (id, name) VALUES (1, 'Algebra')")
+	if err != nil {
+		t.Fatalf("Exec() err = %v; want nil", err)
+	}
+	migratetest.ResetDB(t, db, "sqlite3", migrator)
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM courses").Scan(&n)
+	if err != nil {
+		t.Fatalf("QueryRow() err = %v; want nil", err)
+	}
+	if n != 0 {
+		t.Errorf("courses has %d rows; want ResetDB to recreate it empty", n)
+	}
+	if migrator.AllowReset {
+		t.Errorf("AllowReset = true; want ResetDB to leave the migrator unchanged")
+	}
+}
+
+func TestAssertApplied(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.NewSqlx([]migrate.SqlxMigration{
+		migrate.SqlxQueryMigration("1_create_courses", "CREATE TABLE courses (id int);", "DROP TABLE courses;"),
+		migrate.SqlxQueryMigration("10_create_users", "CREATE TABLE users (id int);", "DROP TABLE users;"),
+	}, migrate.WithSilent())
+
+	// Nothing has been applied, and the migrations table doesn't exist yet.
+	migratetest.AssertApplied(t, db, "sqlite3")
+
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	migratetest.AssertApplied(t, db, "sqlite3", "10_create_users", "1_create_courses")
+
+	fr := &fatalRecorder{TB: t}
+	migratetest.AssertApplied(fr, db, "sqlite3", "1_create_courses", "2_create_widgets")
+	if len(fr.msgs) != 1 {
+		t.Fatalf("Fatalf called %d times; want 1", len(fr.msgs))
+	}
+	for _, want := range []string{"- 2_create_widgets (not applied)", "+ 10_create_users (unexpectedly applied)"} {
+		if !strings.Contains(fr.msgs[0], want) {
+			t.Errorf("Fatalf(%q); want it to contain %q", fr.msgs[0], want)
+		}
+	}
+}
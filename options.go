@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Option configures a Sqlx created with NewSqlx.
+type Option func(s *Sqlx) error
+
+// NewSqlx returns a Sqlx that will run the provided migrations, configured
+// with opts. Options don't panic on bad input; instead any errors they
+// return are collected and reported by Validate, as well as by any method
+// that uses the database.
+//
+// Configuring a Sqlx with a struct literal continues to work.
+func NewSqlx(migrations []SqlxMigration, opts ...Option) *Sqlx {
+	s := &Sqlx{Migrations: migrations}
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			s.optErrs = append(s.optErrs, err)
+		}
+	}
+	return s
+}
+
+// Validate checks the migrator's configuration without touching the
+// database, returning any errors from the options passed to NewSqlx along
+// with invalid table names, empty or duplicate migration IDs, and, if
+// RequireMigrations or RequireRollback are set, a lack of migrations or
+// migrations that can't be rolled back. If StrictOrder is set, it also
+// returns ErrOutOfOrder if Migrations isn't sorted by ID, as CompareIDs
+// orders them.
+func (s *Sqlx) Validate() error {
+	errs := append([]error(nil), s.optErrs...)
+	if s.Store == nil {
+		st := &SQLStore{TableName: s.TableName, IDColumn: s.IDColumn}
+		_, _, err := st.splitTableName()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		_, err = st.idColumn()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if s.HistoryTable != "" && !validTableName.MatchString(s.HistoryTable) {
+		errs = append(errs, fmt.Errorf("invalid history table name: %q", s.HistoryTable))
+	}
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		errs = append(errs, err)
+	} else {
+		if s.RequireMigrations {
+			err = s.checkMigrations(migrations)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if s.StrictOrder {
+			err = checkSorted(s.Migrations)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if s.RequireRollback {
+		err = s.checkRollbacks()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithTableName sets TableName. The name may not be empty.
+func WithTableName(name string) Option {
+	return func(s *Sqlx) error {
+		if name == "" {
+			return errors.New("WithTableName: table name is empty")
+		}
+		_, _, err := (&SQLStore{TableName: name}).splitTableName()
+		if err != nil {
+			return fmt.Errorf("WithTableName: %w", err)
+		}
+		s.TableName = name
+		return nil
+	}
+}
+
+// WithLogger sets Logger. The Logger may not be nil.
+func WithLogger(l Logger) Option {
+	return func(s *Sqlx) error {
+		if l == nil {
+			return errors.New("WithLogger: logger is nil")
+		}
+		s.Logger = l
+		return nil
+	}
+}
+
+// WithSilent sets Logger to one that discards every message.
+func WithSilent() Option {
+	return func(s *Sqlx) error {
+		s.Logger = nopLogger{}
+		return nil
+	}
+}
+
+// WithLocker sets Locker. The Locker may not be nil.
+func WithLocker(l Locker) Option {
+	return func(s *Sqlx) error {
+		if l == nil {
+			return errors.New("WithLocker: locker is nil")
+		}
+		s.Locker = l
+		return nil
+	}
+}
+
+// WithTags sets OnlyTags. At least one tag must be provided.
+func WithTags(tags ...string) Option {
+	return func(s *Sqlx) error {
+		if len(tags) == 0 {
+			return errors.New("WithTags: no tags provided")
+		}
+		s.OnlyTags = tags
+		return nil
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(level Level, msg string, fields ...Field) {}
@@ -0,0 +1,116 @@
+package migrate_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestNewSqlx(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		db := sqliteInMem(t)
+		logger := &recordingLogger{}
+		migrator := migrate.NewSqlx([]migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		}, migrate.WithTableName("schema_versions"), migrate.WithLogger(logger), migrate.WithLocker(&recordingLocker{}))
+		err := migrator.Validate()
+		if err != nil {
+			t.Fatalf("Validate() err = %v; want nil", err)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM schema_versions").Scan(&count)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if count != 1 {
+			t.Errorf("count = %d; want 1", count)
+		}
+		if len(logger.entries) == 0 {
+			t.Errorf("len(entries) = 0; want messages logged to the provided Logger")
+		}
+	})
+
+	t.Run("silent", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.NewSqlx([]migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		}, migrate.WithSilent())
+		migrator.Printf = func(format string, args ...interface{}) (int, error) {
+			t.Errorf("Printf() called; want no output")
+			return 0, nil
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.NewSqlx(nil, migrate.WithTableName(""), migrate.WithLogger(nil), migrate.WithTags(), migrate.WithSilent())
+		err := migrator.Validate()
+		if err == nil {
+			t.Fatalf("Validate() err = nil; want an error")
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want an error")
+		}
+	})
+	t.Run("ids", func(t *testing.T) {
+		tests := map[string]struct {
+			migrations []migrate.SqlxMigration
+			want       error
+			mention    string
+		}{
+			"empty": {
+				migrations: []migrate.SqlxMigration{
+					migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+					migrate.SqlxQueryMigration("", createUsersSql, dropUsersSql),
+				},
+				want:    migrate.ErrEmptyID,
+				mention: "position 1",
+			},
+			"duplicate": {
+				migrations: []migrate.SqlxMigration{
+					migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+					migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+					migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				},
+				want:    migrate.ErrDuplicateID,
+				mention: "positions 0 and 2",
+			},
+		}
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				db := sqliteInMem(t)
+				migrator := migrate.NewSqlx(tc.migrations, migrate.WithSilent())
+				err := migrator.Validate()
+				if !errors.Is(err, tc.want) {
+					t.Fatalf("Validate() err = %v; want %v", err, tc.want)
+				}
+				if !strings.Contains(err.Error(), tc.mention) {
+					t.Errorf("Validate() err = %v; want it to mention %q", err, tc.mention)
+				}
+				err = migrator.Migrate(db, "sqlite3")
+				if !errors.Is(err, tc.want) {
+					t.Fatalf("Migrate() err = %v; want %v", err, tc.want)
+				}
+				var n int
+				err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master").Scan(&n)
+				if err != nil {
+					t.Fatalf("QueryRow() err = %v; want nil", err)
+				}
+				if n != 0 {
+					t.Errorf("tables = %d; want no SQL run", n)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrDuplicateID is returned when two of the configured migrations share the
+// same ID.
+var ErrDuplicateID = errors.New("duplicate migration id")
+
+// ErrEmptyID is returned when one of the configured migrations doesn't have
+// an ID.
+var ErrEmptyID = errors.New("empty migration id")
+
+// ErrOutOfOrder is returned when StrictOrder is set and a pending migration
+// sorts before a migration that has already been run. Validate also returns
+// it when StrictOrder is set and the configured migrations aren't sorted.
+var ErrOutOfOrder = errors.New("migration out of order")
+
+// checkOrder returns ErrOutOfOrder if any of the migrations that haven't been
+// applied sort before the latest applied one. Only migrations are considered,
+// so applied migrations that are excluded by OnlyTags or no longer configured
+// don't count towards the latest.
+func checkOrder(migrations []SqlxMigration, applied map[string]AppliedMigration) error {
+	var latest string
+	for _, m := range migrations {
+		if _, ok := applied[m.ID]; !ok {
+			continue
+		}
+		if latest == "" || CompareIDs(m.ID, latest) > 0 {
+			latest = m.ID
+		}
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.ID]; ok {
+			continue
+		}
+		if latest != "" && CompareIDs(m.ID, latest) < 0 {
+			return fmt.Errorf("%w: %q is pending but %q has already been run", ErrOutOfOrder, m.ID, latest)
+		}
+	}
+	return nil
+}
+
+// checkSorted returns ErrOutOfOrder if migrations aren't in the order
+// sortedMigrations would put them in.
+func checkSorted(migrations []SqlxMigration) error {
+	for i := 1; i < len(migrations); i++ {
+		prev, m := migrations[i-1], migrations[i]
+		if CompareIDs(prev.ID, m.ID) > 0 {
+			return fmt.Errorf("%w: %q is configured before %q but sorts after it", ErrOutOfOrder, prev.ID, m.ID)
+		}
+	}
+	return nil
+}
+
+// sortedMigrations returns a copy of the configured migrations sorted by ID,
+// leaving s.Migrations untouched. Migrations excluded by OnlyTags are left
+// out. Every configured migration is checked by checkIDs first, whether or
+// not it is excluded. Since IDs are unique and CompareIDs only returns zero
+// for equal IDs, the result doesn't depend on the order of s.Migrations.
+func (s *Sqlx) sortedMigrations() ([]SqlxMigration, error) {
+	err := s.checkIDs()
+	if err != nil {
+		return nil, err
+	}
+	migrations := make([]SqlxMigration, len(s.Migrations))
+	copy(migrations, s.Migrations)
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return CompareIDs(migrations[i].ID, migrations[j].ID) < 0
+	})
+	if len(s.OnlyTags) == 0 {
+		return migrations, nil
+	}
+	included := migrations[:0]
+	for _, m := range migrations {
+		if s.included(m) {
+			included = append(included, m)
+		}
+	}
+	return included, nil
+}
+
+// checkIDs returns ErrEmptyID if a configured migration has no ID, or
+// ErrDuplicateID if two share the same ID. Errors include the migration's
+// position in s.Migrations so that copy-paste mistakes are easy to find.
+func (s *Sqlx) checkIDs() error {
+	seen := make(map[string]int, len(s.Migrations))
+	for i, m := range s.Migrations {
+		if m.ID == "" {
+			return fmt.Errorf("%w: migration at position %d", ErrEmptyID, i)
+		}
+		if j, ok := seen[m.ID]; ok {
+			return fmt.Errorf("%w: %q at positions %d and %d", ErrDuplicateID, m.ID, j, i)
+		}
+		seen[m.ID] = i
+	}
+	return nil
+}
+
+// included reports whether m has one of the tags in OnlyTags, or true if
+// OnlyTags isn't set.
+func (s *Sqlx) included(m SqlxMigration) bool {
+	if len(s.OnlyTags) == 0 {
+		return true
+	}
+	for _, tag := range m.Tags {
+		if containsString(s.OnlyTags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// appliedOrder returns a copy of migrations with those that have been
+// applied rearranged into the order they were applied in, by AppliedAt, so
+// that iterating it in reverse rolls back the most recently applied migration
+// first even if it sorts before others. Migrations that haven't been applied
+// keep their positions. Migrations applied at the same time, or recorded
+// before applied_at was tracked, keep the order of their IDs.
+func appliedOrder(migrations []SqlxMigration, applied map[string]AppliedMigration) []SqlxMigration {
+	var slots []int
+	var ordered []SqlxMigration
+	for i, m := range migrations {
+		if _, ok := applied[m.ID]; ok {
+			slots = append(slots, i)
+			ordered = append(ordered, m)
+		}
+	}
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return applied[ordered[i].ID].AppliedAt.Before(applied[ordered[j].ID].AppliedAt)
+	})
+	result := append([]SqlxMigration(nil), migrations...)
+	for k, i := range slots {
+		result[i] = ordered[k]
+	}
+	return result
+}
+
+// indexOf returns the position of the migration with the provided id.
+func indexOf(migrations []SqlxMigration, id string) (int, error) {
+	for i, m := range migrations {
+		if m.ID == id {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%w: %q", ErrMigrationNotFound, id)
+}
+
+// CompareIDs compares two migration IDs, treating runs of digits as numbers
+// so that "2_users" sorts before "10_widgets". It returns a negative number
+// if a sorts before b, a positive number if a sorts after b, and zero if they
+// are equal. This is the order Sqlx runs migrations in, and it can be used
+// with sort.Slice to order IDs the same way.
+func CompareIDs(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if isDigit(a[i]) && isDigit(b[j]) {
+			si, sj := i, j
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			if c := compareNumbers(a[si:i], b[sj:j]); c != 0 {
+				return c
+			}
+			continue
+		}
+		if a[i] != b[j] {
+			if a[i] < b[j] {
+				return -1
+			}
+			return 1
+		}
+		i++
+		j++
+	}
+	switch {
+	case len(a)-i < len(b)-j:
+		return -1
+	case len(a)-i > len(b)-j:
+		return 1
+	}
+	// The IDs are equivalent numerically, eg "01_a" and "1_a", so fall back to
+	// a plain comparison to keep the ordering total.
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareNumbers compares two strings of digits by their numeric value
+// without parsing them, so arbitrarily long numbers are supported.
+func compareNumbers(a, b string) int {
+	for len(a) > 1 && a[0] == '0' {
+		a = a[1:]
+	}
+	for len(b) > 1 && b[0] == '0' {
+		b = b[1:]
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,120 @@
+package migrate_test
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestCompareIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1_init", "1_init", 0},
+		{"2_users", "10_foo", -1},
+		{"10_foo", "2_users", 1},
+		{"001_a", "2_b", -1},
+		{"0010_a", "9_a", 1},
+		{"1_a", "1_b", -1},
+		{"1_users2", "1_users10", -1},
+		{"20240101120000_a", "20240101120000_b", -1},
+		{"v2", "v10", -1},
+		{"1", "1_a", -1},
+		{"01_a", "1_a", -1},
+		{"alpha", "beta", -1},
+	}
+	for _, tc := range tests {
+		got := migrate.CompareIDs(tc.a, tc.b)
+		if sign(got) != tc.want {
+			t.Errorf("CompareIDs(%q, %q) = %d; want sign %d", tc.a, tc.b, got, tc.want)
+		}
+		if back := migrate.CompareIDs(tc.b, tc.a); sign(back) != -tc.want {
+			t.Errorf("CompareIDs(%q, %q) = %d; want sign %d", tc.b, tc.a, back, -tc.want)
+		}
+	}
+
+	ids := []string{"10_foo", "2_users", "1_init", "010_bar", "3_a", "3"}
+	sort.Slice(ids, func(i, j int) bool {
+		return migrate.CompareIDs(ids[i], ids[j]) < 0
+	})
+	want := []string{"1_init", "2_users", "3", "3_a", "010_bar", "10_foo"}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Fatalf("sorted = %v; want %v", ids, want)
+		}
+	}
+}
+
+func TestSqlx_sortedOrder(t *testing.T) {
+	want := []string{"1", "01_a", "1_a", "1_b", "2", "2_users", "10", "010_bar", "10_foo", "alpha", "v2", "v10"}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		ids := append([]string(nil), want...)
+		rng.Shuffle(len(ids), func(i, j int) {
+			ids[i], ids[j] = ids[j], ids[i]
+		})
+		var migrations []migrate.SqlxMigration
+		for _, id := range ids {
+			migrations = append(migrations, migrate.SqlxQueryMigration(id, "", ""))
+		}
+		got, err := migrate.SortedIDs(migrate.NewSqlx(migrations))
+		if err != nil {
+			t.Fatalf("SortedIDs() err = %v; want nil", err)
+		}
+		for j := range want {
+			if got[j] != want[j] {
+				t.Fatalf("SortedIDs(%v) = %v; want %v", ids, got, want)
+			}
+		}
+	}
+}
+
+func TestSqlx_Validate_strictOrder(t *testing.T) {
+	unsorted := []migrate.SqlxMigration{
+		migrate.SqlxQueryMigration("2_users", "", ""),
+		migrate.SqlxQueryMigration("10_widgets", "", ""),
+		migrate.SqlxQueryMigration("1_init", "", ""),
+	}
+	err := migrate.NewSqlx(unsorted).Validate()
+	if err != nil {
+		t.Fatalf("Validate() err = %v; want nil without StrictOrder", err)
+	}
+	migrator := migrate.NewSqlx(unsorted)
+	migrator.StrictOrder = true
+	err = migrator.Validate()
+	if !errors.Is(err, migrate.ErrOutOfOrder) {
+		t.Fatalf("Validate() err = %v; want %v", err, migrate.ErrOutOfOrder)
+	}
+
+	fsys := fstest.MapFS{
+		"sql/10_widgets.sql": {Data: []byte("")},
+		"sql/2_users.sql":    {Data: []byte("")},
+		"sql/1_init.sql":     {Data: []byte("")},
+		"sql/01_seed.sql":    {Data: []byte("")},
+	}
+	migrations, err := migrate.GlobMigrations(fsys, "sql/*.sql")
+	if err != nil {
+		t.Fatalf("GlobMigrations() err = %v; want nil", err)
+	}
+	migrator = migrate.NewSqlx(migrations)
+	migrator.StrictOrder = true
+	err = migrator.Validate()
+	if err != nil {
+		t.Fatalf("Validate() err = %v; want nil for loaded migrations", err)
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
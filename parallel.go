@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrDependencyCycle is returned when the DependsOn fields of the pending
+// migrations form a cycle, so none of the migrations in it could ever run.
+var ErrDependencyCycle = errors.New("migration dependency cycle")
+
+// upParallel runs the pending migrations using up to s.Workers goroutines,
+// starting each one once every migration it depends on has been applied. It
+// is called by up once the migrations table is ready and the applied
+// migrations have been checked.
+func (s *Sqlx) upParallel(ctx context.Context, db *sqlx.DB, store Store, migrations []SqlxMigration, applied map[string]AppliedMigration, res *MigrateResult) error {
+	var pending []SqlxMigration
+	for _, m := range migrations {
+		if a, ok := applied[m.ID]; ok {
+			err := s.skip(m, a, res)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		pending = append(pending, m)
+	}
+
+	// waiting counts the unapplied dependencies of each pending migration,
+	// and dependents lists the migrations waiting on each one.
+	position := make(map[string]int, len(pending))
+	for i, m := range pending {
+		position[m.ID] = i
+	}
+	waiting := make([]int, len(pending))
+	dependents := make([][]int, len(pending))
+	for i, m := range pending {
+		for _, dep := range m.DependsOn {
+			if _, ok := applied[dep]; ok {
+				continue
+			}
+			j, ok := position[dep]
+			if !ok {
+				return fmt.Errorf("migration %q depends on %q: %w", m.ID, dep, ErrMigrationNotFound)
+			}
+			waiting[i]++
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+	err := checkCycles(pending, waiting, dependents)
+	if err != nil {
+		return err
+	}
+
+	done, total := 0, len(pending)
+	var ready []int
+	for i := range pending {
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	type result struct {
+		i    int
+		d    time.Duration
+		rows *rowCounter
+		err  error
+	}
+	results := make(chan result)
+	running := 0
+	var failed []error
+	for len(ready) > 0 || running > 0 {
+		for running < s.Workers && len(ready) > 0 && len(failed) == 0 {
+			err := ctx.Err()
+			if err != nil {
+				failed = append(failed, err)
+				break
+			}
+			i := ready[0]
+			ready = ready[1:]
+			m := s.logRunning(db.DriverName(), pending[i], done+running, total)
+			running++
+			go func() {
+				start := s.now()
+				stepCtx, rows := withRowCounter(ctx)
+				err := s.migrateStep(stepCtx, db, nil, store, m)
+				results <- result{i: i, d: s.now().Sub(start), rows: rows, err: err}
+			}()
+		}
+		if running == 0 {
+			break
+		}
+		r := <-results
+		running--
+		m := pending[r.i]
+		res.Durations[m.ID] = r.d
+		done++
+		s.progress(done, total)
+		if r.err != nil {
+			s.log(LevelError, "Migration failed: "+m.ID, Field{"id", m.ID}, Field{"outcome", "failed"}, Field{"error", r.err})
+			s.event(StepEvent{ID: m.ID, Direction: DirectionUp, Outcome: OutcomeFailed, Duration: r.d, Err: r.err})
+			failed = append(failed, r.err)
+			continue
+		}
+		s.event(StepEvent{ID: m.ID, Direction: DirectionUp, Outcome: OutcomeApplied, Duration: r.d})
+		res.Applied = append(res.Applied, m.ID)
+		r.rows.record(res, m.ID)
+		for _, j := range dependents[r.i] {
+			waiting[j]--
+			if waiting[j] == 0 {
+				ready = append(ready, j)
+			}
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// checkCycles returns ErrDependencyCycle, listing the migrations involved,
+// if the pending migrations can't all be run because their dependencies form
+// a cycle.
+func checkCycles(pending []SqlxMigration, waiting []int, dependents [][]int) error {
+	remaining := append([]int(nil), waiting...)
+	var queue []int
+	for i, n := range remaining {
+		if n == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		for _, j := range dependents[i] {
+			remaining[j]--
+			if remaining[j] == 0 {
+				queue = append(queue, j)
+			}
+		}
+	}
+	var cycle []string
+	for i, n := range remaining {
+		if n > 0 {
+			cycle = append(cycle, pending[i].ID)
+		}
+	}
+	if len(cycle) > 0 {
+		return fmt.Errorf("%w: %q", ErrDependencyCycle, cycle)
+	}
+	return nil
+}
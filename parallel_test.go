@@ -0,0 +1,162 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joncalhoun/migrate"
+)
+
+func TestWorkers(t *testing.T) {
+	db, err := sql.Open("migrate_noop", "")
+	if err != nil {
+		t.Fatalf("Open() err = %v; want nil", err)
+	}
+	defer db.Close()
+
+	// tracker records which migrations have finished and how many ran at
+	// once.
+	type tracker struct {
+		mu       sync.Mutex
+		done     map[string]bool
+		running  int
+		maxAtOne int
+	}
+	fake := func(tr *tracker, id string, err error, deps ...string) migrate.SqlxMigration {
+		return migrate.SqlxMigration{
+			ID:        id,
+			DependsOn: deps,
+			Migrate: func(tx *sqlx.Tx) error {
+				tr.mu.Lock()
+				for _, dep := range deps {
+					if !tr.done[dep] {
+						t.Errorf("%s started before its dependency %s finished", id, dep)
+					}
+				}
+				tr.running++
+				if tr.running > tr.maxAtOne {
+					tr.maxAtOne = tr.running
+				}
+				tr.mu.Unlock()
+
+				if err == nil {
+					time.Sleep(20 * time.Millisecond)
+				}
+
+				tr.mu.Lock()
+				tr.running--
+				tr.done[id] = true
+				tr.mu.Unlock()
+				return err
+			},
+		}
+	}
+	newMigrator := func(t *testing.T, store migrate.Store, migrations ...migrate.SqlxMigration) migrate.Sqlx {
+		return migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: migrations,
+			Store:      store,
+			Workers:    3,
+		}
+	}
+
+	t.Run("dependencies", func(t *testing.T) {
+		tr := &tracker{done: make(map[string]bool)}
+		store := &migrate.InMemoryStore{}
+		migrator := newMigrator(t, store,
+			fake(tr, "001_create_courses", nil),
+			fake(tr, "002_create_users", nil),
+			fake(tr, "003_create_widgets", nil),
+			fake(tr, "004_create_gadgets", nil),
+			fake(tr, "005_create_enrollments", nil, "001_create_courses", "002_create_users"),
+			fake(tr, "006_seed_enrollments", nil, "005_create_enrollments"),
+		)
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if len(res.Applied) != 6 {
+			t.Errorf("len(Applied) = %d; want 6", len(res.Applied))
+		}
+		if tr.maxAtOne < 2 || tr.maxAtOne > 3 {
+			t.Errorf("max concurrent migrations = %d; want 2 or 3", tr.maxAtOne)
+		}
+
+		// Already applied dependencies are satisfied.
+		migrator.Migrations = append(migrator.Migrations, fake(tr, "007_more_seeds", nil, "006_seed_enrollments"))
+		res, err = migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if len(res.Applied) != 1 || len(res.Skipped) != 6 {
+			t.Errorf("Applied, Skipped = %v, %v; want 1 applied and 6 skipped", res.Applied, res.Skipped)
+		}
+		if !res.WasApplied("007_more_seeds") || res.WasApplied("006_seed_enrollments") {
+			t.Errorf("Applied = %v; want WasApplied to be true for 007_more_seeds only", res.Applied)
+		}
+	})
+
+	t.Run("failure stops queued work", func(t *testing.T) {
+		tr := &tracker{done: make(map[string]bool)}
+		store := &migrate.InMemoryStore{}
+		migrator := newMigrator(t, store,
+			fake(tr, "001_broken", errors.New("boom")),
+			fake(tr, "002_create_users", nil, "001_broken"),
+			fake(tr, "003_create_widgets", nil, "001_broken"),
+		)
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want error")
+		}
+		if len(store.IDs()) != 0 {
+			t.Errorf("IDs() = %v; want none", store.IDs())
+		}
+		if tr.done["002_create_users"] || tr.done["003_create_widgets"] {
+			t.Errorf("queued migrations ran after a failure")
+		}
+	})
+
+	for name, tc := range map[string]struct {
+		migrations func(tr *tracker) []migrate.SqlxMigration
+		want       error
+	}{
+		"cycle": {
+			migrations: func(tr *tracker) []migrate.SqlxMigration {
+				return []migrate.SqlxMigration{
+					fake(tr, "001_create_courses", nil),
+					fake(tr, "002_create_users", nil, "003_create_widgets"),
+					fake(tr, "003_create_widgets", nil, "002_create_users"),
+				}
+			},
+			want: migrate.ErrDependencyCycle,
+		},
+		"unknown dependency": {
+			migrations: func(tr *tracker) []migrate.SqlxMigration {
+				return []migrate.SqlxMigration{
+					fake(tr, "001_create_courses", nil, "000_missing"),
+				}
+			},
+			want: migrate.ErrMigrationNotFound,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tr := &tracker{done: make(map[string]bool)}
+			store := &migrate.InMemoryStore{}
+			migrator := newMigrator(t, store, tc.migrations(tr)...)
+			err := migrator.Migrate(db, "sqlite3")
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("Migrate() err = %v; want %v", err, tc.want)
+			}
+			if len(tr.done) != 0 {
+				t.Errorf("migrations ran = %v; want none", tr.done)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RetryPolicy controls how migrations that fail with transient errors, such
+// as serialization failures or dropped connections, are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a migration is run,
+	// including the first attempt. Values less than 2 disable retries.
+	MaxAttempts int
+	// Backoff returns how long to wait before the provided retry, starting
+	// at 1 for the first retry. If nil, retries happen immediately.
+	Backoff func(retry int) time.Duration
+	// IsRetryable reports whether an error is transient. Only errors it
+	// returns true for are retried. If nil, nothing is retried.
+	IsRetryable func(err error) bool
+}
+
+// ExponentialBackoff returns a Backoff function that waits base before the
+// first retry and doubles the wait for each retry after that, up to max.
+func ExponentialBackoff(base, max time.Duration) func(retry int) time.Duration {
+	return func(retry int) time.Duration {
+		d := base
+		for i := 1; i < retry && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// runMigrationWithRetry runs m, retrying according to Retry. Each attempt
+// runs in a fresh transaction, so migrations run in a transaction provided
+// by the caller, or with DisableTx set, are never retried.
+func (s *Sqlx) runMigrationWithRetry(ctx context.Context, db *sqlx.DB, tx *sqlx.Tx, store Store, m SqlxMigration) error {
+	err := s.runMigration(ctx, db, tx, store, m)
+	p := s.Retry
+	if p == nil || p.IsRetryable == nil || tx != nil || m.DisableTx {
+		return err
+	}
+	for attempt := 2; attempt <= p.MaxAttempts && err != nil && p.IsRetryable(err); attempt++ {
+		var wait time.Duration
+		if p.Backoff != nil {
+			wait = p.Backoff(attempt - 1)
+		}
+		s.log(LevelInfo, "Retrying migration: "+m.ID, Field{"id", m.ID}, Field{"attempt", attempt}, Field{"error", err})
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		err = s.runMigration(ctx, db, tx, store, m)
+	}
+	return err
+}
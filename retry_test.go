@@ -0,0 +1,103 @@
+package migrate_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSqlx_Retry(t *testing.T) {
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+
+	tests := map[string]struct {
+		failures    []error
+		maxAttempts int
+		wantErr     error
+		wantRuns    int
+	}{
+		"succeeds after retries": {
+			failures:    []error{errTransient, errTransient},
+			maxAttempts: 3,
+			wantRuns:    3,
+		},
+		"gives up": {
+			failures:    []error{errTransient, errTransient, errTransient},
+			maxAttempts: 2,
+			wantErr:     errTransient,
+			wantRuns:    2,
+		},
+		"not retryable": {
+			failures:    []error{errPermanent},
+			maxAttempts: 3,
+			wantErr:     errPermanent,
+			wantRuns:    1,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := sqliteInMem(t)
+			var runs int
+			var waits []time.Duration
+			migrator := migrate.Sqlx{
+				Printf: func(format string, args ...interface{}) (int, error) {
+					t.Logf(format, args...)
+					return 0, nil
+				},
+				Migrations: []migrate.SqlxMigration{
+					{
+						ID: "001_create_courses",
+						Migrate: func(tx *sqlx.Tx) error {
+							// Each attempt must get a fresh transaction, so the table
+							// created by a failed attempt is never visible.
+							_, err := tx.Exec(createCoursesSql)
+							if err != nil {
+								return err
+							}
+							runs++
+							if runs <= len(tc.failures) {
+								return tc.failures[runs-1]
+							}
+							return nil
+						},
+					},
+				},
+				Retry: &migrate.RetryPolicy{
+					MaxAttempts: tc.maxAttempts,
+					Backoff: func(retry int) time.Duration {
+						d := migrate.ExponentialBackoff(time.Millisecond, 2*time.Millisecond)(retry)
+						waits = append(waits, d)
+						return d
+					},
+					IsRetryable: func(err error) bool {
+						return errors.Is(err, errTransient)
+					},
+				},
+			}
+			err := migrator.Migrate(db, "sqlite3")
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Migrate() err = %v; want %v", err, tc.wantErr)
+			}
+			if runs != tc.wantRuns {
+				t.Errorf("runs = %d; want %d", runs, tc.wantRuns)
+			}
+			for i, d := range waits {
+				want := time.Millisecond << i
+				if want > 2*time.Millisecond {
+					want = 2 * time.Millisecond
+				}
+				if d != want {
+					t.Errorf("waits[%d] = %v; want %v", i, d, want)
+				}
+			}
+			if tc.wantErr == nil {
+				assertApplied(t, db, "001_create_courses")
+			} else {
+				assertApplied(t, db)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// rowCounter totals the rows affected by the statements a migration runs, as
+// reported in MigrateResult.RowsAffected.
+type rowCounter struct {
+	n int64
+	// counted is set once any statement has been counted, and unsupported
+	// once the driver has failed to report the rows a statement affected.
+	counted, unsupported bool
+}
+
+// add counts the rows affected by a statement.
+func (c *rowCounter) add(res sql.Result) {
+	c.counted = true
+	n, err := res.RowsAffected()
+	if err != nil {
+		c.unsupported = true
+		return
+	}
+	c.n += n
+}
+
+// reset discards everything counted so far, such as before a migration is
+// retried.
+func (c *rowCounter) reset() {
+	*c = rowCounter{}
+}
+
+// record adds the total to res under id, if any statements were counted. The
+// total is -1 if the driver didn't report the rows affected by any of them.
+func (c *rowCounter) record(res *MigrateResult, id string) {
+	if !c.counted {
+		return
+	}
+	n := c.n
+	if c.unsupported {
+		n = -1
+	}
+	res.RowsAffected[id] = n
+}
+
+type rowCounterKey struct{}
+
+// withRowCounter returns a copy of ctx carrying a new rowCounter, along with
+// the counter, so that the rows affected by a migration run with ctx are
+// counted.
+func withRowCounter(ctx context.Context) (context.Context, *rowCounter) {
+	c := &rowCounter{}
+	return context.WithValue(ctx, rowCounterKey{}, c), c
+}
+
+// rowCounterFrom returns the rowCounter carried by ctx, or nil if there isn't
+// one.
+func rowCounterFrom(ctx context.Context) *rowCounter {
+	c, _ := ctx.Value(rowCounterKey{}).(*rowCounter)
+	return c
+}
+
+// execCounted runs query with tx, counting the rows it affects with rows if
+// it isn't nil.
+func execCounted(tx *sqlx.Tx, rows *rowCounter, query string) error {
+	res, err := tx.Exec(query)
+	if err != nil {
+		return err
+	}
+	if rows != nil {
+		rows.add(res)
+	}
+	return nil
+}
+
+// sqlExec runs the SQL of a migration created by one of the SQL helpers,
+// such as SqlxQueryMigration, counting the rows it affects with rows if it
+// isn't nil.
+type sqlExec func(tx *sqlx.Tx, rows *rowCounter) error
+
+// sqlStep is the Migrate func of a migration created by one of the SQL
+// helpers. Migrate funcs are only passed the transaction, so Sqlx registers
+// the rowCounter of the transaction it is running the migration in with the
+// step, and the step counts the rows it affects with it. If Migrate is
+// replaced the step is never run and nothing is counted.
+type sqlStep struct {
+	exec sqlExec
+	mu   sync.Mutex
+	rows map[*sqlx.Tx]*rowCounter
+}
+
+// newSQLStep returns a sqlStep that runs exec, or nil if exec is nil.
+func newSQLStep(exec sqlExec) *sqlStep {
+	if exec == nil {
+		return nil
+	}
+	return &sqlStep{exec: exec}
+}
+
+// migrate returns the func to use for Migrate, or nil if st is nil.
+func (st *sqlStep) migrate() func(tx *sqlx.Tx) error {
+	if st == nil {
+		return nil
+	}
+	return func(tx *sqlx.Tx) error {
+		st.mu.Lock()
+		rows := st.rows[tx]
+		st.mu.Unlock()
+		return st.exec(tx, rows)
+	}
+}
+
+// track counts the rows affected by the step when it is run in tx with rows,
+// until the returned function is called.
+func (st *sqlStep) track(tx *sqlx.Tx, rows *rowCounter) func() {
+	if st == nil || rows == nil {
+		return func() {}
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.rows == nil {
+		st.rows = make(map[*sqlx.Tx]*rowCounter)
+	}
+	st.rows[tx] = rows
+	return func() {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		delete(st.rows, tx)
+	}
+}
+
+// sqlRollback returns the func to use for Rollback, or nil if exec is nil.
+func sqlRollback(exec sqlExec) func(tx *sqlx.Tx) error {
+	if exec == nil {
+		return nil
+	}
+	return func(tx *sqlx.Tx) error {
+		return exec(tx, nil)
+	}
+}
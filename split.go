@@ -0,0 +1,121 @@
+package migrate
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// FileOption configures how SQL read from a file is run.
+type FileOption func(*fileOptions)
+
+type fileOptions struct {
+	splitStatements bool
+}
+
+// WithStatementSplitting controls whether the SQL in a file is split into
+// individual statements, each run with its own Exec call inside the
+// migration's transaction. This is needed for drivers that don't support
+// multiple statements per Exec, such as the MySQL driver without
+// multiStatements=true. Statements are split on semicolons, ignoring any
+// inside quotes or comments, which are recognized using the same rules for
+// the migration's dialect as StripComments. It is disabled by default, in
+// which case the whole file is run with a single Exec.
+func WithStatementSplitting(split bool) FileOption {
+	return func(o *fileOptions) {
+		o.splitStatements = split
+	}
+}
+
+// execStatements runs query with tx, splitting it into individual statements
+// first if split is true, and counts the rows affected with rows if it isn't
+// nil.
+func execStatements(tx *sqlx.Tx, rows *rowCounter, query string, split bool) error {
+	if !split {
+		return execCounted(tx, rows, query)
+	}
+	for _, stmt := range splitStatements(query, tx.DriverName()) {
+		err := execCounted(tx, rows, stmt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitStatements splits sql into individual statements on semicolons that
+// aren't inside a quoted string, quoted identifier, or comment, following the
+// same rules for dialect as StripComments. Statements are trimmed of
+// surrounding whitespace and the terminating delimiter, and statements that
+// are empty or only contain comments are dropped.
+//
+// MySQL DELIMITER directives on a line of their own change the delimiter
+// used to end statements until the next DELIMITER directive, and are removed
+// from the output since they are a client command rather than SQL.
+func splitStatements(sql, dialect string) []string {
+	r := sqlRulesFor(dialect)
+	var stmts []string
+	delim := ";"
+	start := 0
+	hasSQL := false
+	lineStart := true
+	flush := func(end int) {
+		stmt := strings.TrimSpace(sql[start:end])
+		if hasSQL && stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		hasSQL = false
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		if c == '\n' {
+			lineStart = true
+			i++
+			continue
+		}
+		if c == ' ' || c == '\t' || c == '\r' {
+			i++
+			continue
+		}
+		if lineStart && isDelimiterDirective(sql[i:]) {
+			flush(i)
+			end := lineCommentEnd(sql, i)
+			fields := strings.Fields(sql[i:end])
+			if len(fields) > 1 {
+				delim = fields[1]
+			}
+			i = min(end+1, len(sql))
+			start = i
+			continue
+		}
+		lineStart = false
+
+		if strings.HasPrefix(sql[i:], delim) {
+			flush(i)
+			i += len(delim)
+			start = i
+			continue
+		}
+		// Line comments end before their newline, which is left for the loop
+		// so that a DELIMITER directive on the following line is recognized.
+		kind, end := r.nextToken(sql, i)
+		if kind != tokenLineComment && kind != tokenBlockComment {
+			hasSQL = true
+		}
+		i = end
+	}
+	flush(len(sql))
+	return stmts
+}
+
+// isDelimiterDirective reports whether s starts with a MySQL DELIMITER
+// directive.
+func isDelimiterDirective(s string) bool {
+	const directive = "DELIMITER"
+	if len(s) <= len(directive) || !strings.EqualFold(s[:len(directive)], directive) {
+		return false
+	}
+	c := s[len(directive)]
+	return c == ' ' || c == '\t'
+}
@@ -0,0 +1,149 @@
+package migrate_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := map[string]struct {
+		sql     string
+		dialect string
+		want    []string
+	}{
+		"single": {
+			sql:  "CREATE TABLE a (id int);",
+			want: []string{"CREATE TABLE a (id int)"},
+		},
+		"no trailing semicolon": {
+			sql:  "SELECT 1; SELECT 2",
+			want: []string{"SELECT 1", "SELECT 2"},
+		},
+		"quotes": {
+			sql:  `INSERT INTO a VALUES ('a;b', "c;d", ` + "`e;f`" + `, 'it''s;');`,
+			want: []string{`INSERT INTO a VALUES ('a;b', "c;d", ` + "`e;f`" + `, 'it''s;')`},
+		},
+		"line comments": {
+			sql:  "-- first; comment\nSELECT 1; -- second; comment\nSELECT 2;",
+			want: []string{"-- first; comment\nSELECT 1", "-- second; comment\nSELECT 2"},
+		},
+		"block comments": {
+			sql:  "/* a;\nb */ SELECT 1;",
+			want: []string{"/* a;\nb */ SELECT 1"},
+		},
+		"comment only": {
+			sql:  "SELECT 1;\n-- done;\n",
+			want: []string{"SELECT 1"},
+		},
+		"positional parameters": {
+			sql:  "UPDATE a SET b = $1 WHERE c = $2; SELECT 1;",
+			want: []string{"UPDATE a SET b = $1 WHERE c = $2", "SELECT 1"},
+		},
+		"lowercase delimiter": {
+			sql:  "delimiter $$\nSELECT 1; SELECT 2$$\ndelimiter ;\nSELECT 3;",
+			want: []string{"SELECT 1; SELECT 2", "SELECT 3"},
+		},
+		"brackets": {
+			sql:     "SELECT [a;b]; SELECT 2;",
+			dialect: "sqlserver",
+			want:    []string{"SELECT [a;b]", "SELECT 2"},
+		},
+		"mysql executable comments": {
+			sql:     "/*!40101 SET NAMES utf8; */; SELECT 1--1;",
+			dialect: "mysql",
+			want:    []string{"/*!40101 SET NAMES utf8; */", "SELECT 1--1"},
+		},
+		"nested comments": {
+			sql:     "/* a /* b; */ c; */ SELECT 1;",
+			dialect: "postgres",
+			want:    []string{"/* a /* b; */ c; */ SELECT 1"},
+		},
+		"empty statements": {
+			sql:  ";;SELECT 1;;",
+			want: []string{"SELECT 1"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := migrate.SplitStatements(tc.sql, tc.dialect)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("SplitStatements() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSplitStatements_functionBodies(t *testing.T) {
+	tests := map[string]struct {
+		dialect string
+		want    []string
+	}{
+		"testdata/trigger_function.pg.sql": {"postgres", []string{
+			"CREATE TABLE widgets (\n  id serial PRIMARY KEY,\n  name text NOT NULL,\n  updated_at timestamptz\n)",
+			"CREATE FUNCTION set_updated_at() RETURNS trigger AS $$\nBEGIN\n  NEW.updated_at = now();\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql",
+			"CREATE FUNCTION widget_label(w widgets) RETURNS text AS $body$\n  SELECT 'widget; ' || w.name;\n$body$ LANGUAGE sql",
+			"CREATE TRIGGER widgets_updated_at\n  BEFORE UPDATE ON widgets\n  FOR EACH ROW EXECUTE FUNCTION set_updated_at()",
+		}},
+		"testdata/procedure.mysql.sql": {"mysql", []string{
+			"CREATE TABLE widgets (\n  id INT AUTO_INCREMENT PRIMARY KEY,\n  name VARCHAR(255) NOT NULL\n)",
+			"CREATE PROCEDURE add_widget(IN widget_name VARCHAR(255))\nBEGIN\n  INSERT INTO widgets (name) VALUES (widget_name);\n  SELECT LAST_INSERT_ID();\nEND",
+			"CALL add_widget('first; widget')",
+		}},
+		"testdata/escapes.mysql.sql": {"mysql", []string{
+			`INSERT INTO widgets (name) VALUES ('it\'s; escaped')`,
+			`INSERT INTO widgets (name) VALUES ("say \"hi;\"", 'back\\')`,
+			"SELECT 1",
+		}},
+	}
+	for filename, tc := range tests {
+		t.Run(filename, func(t *testing.T) {
+			b, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("ReadFile() err = %v; want nil", err)
+			}
+			got := migrate.SplitStatements(string(b), tc.dialect)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("SplitStatements() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestWithStatementSplitting(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxFileMigration("002_seed_courses", "testdata/seed.sql", "", migrate.WithStatementSplitting(true)),
+		},
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	var got []string
+	rows, err := db.Query("SELECT name FROM courses ORDER BY id")
+	if err != nil {
+		t.Fatalf("db.Query() err = %v; want nil", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			t.Fatalf("rows.Scan() err = %v; want nil", err)
+		}
+		got = append(got, name)
+	}
+	want := []string{"semi;colon", "it's; quoted", "double;quoted"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("names = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// prepareSQLite enables WAL mode if SQLiteWAL is set and sets the busy
+// timeout on the connection pool, for the sqlite3 dialect only. It is called
+// before Migrate and Rollback do any work.
+func (s *Sqlx) prepareSQLite(ctx context.Context, db *sqlx.DB) error {
+	if db.DriverName() != "sqlite3" {
+		return nil
+	}
+	if s.SQLiteWAL {
+		// journal_mode can't be changed inside a transaction, but WAL mode
+		// is a property of the database file so it only needs to be set
+		// on one connection.
+		var mode string
+		err := db.QueryRowContext(ctx, "PRAGMA journal_mode=WAL").Scan(&mode)
+		if err != nil {
+			return fmt.Errorf("enabling WAL mode: %w", err)
+		}
+		if !strings.EqualFold(mode, "wal") {
+			s.log(LevelInfo, "WAL mode isn't supported by this database, using journal mode "+mode, Field{"journal_mode", mode})
+		}
+	}
+	return s.setBusyTimeout(ctx, db)
+}
+
+// setBusyTimeout sets SQLiteBusyTimeout on the connection ex uses, if it is
+// set and the dialect is sqlite3.
+func (s *Sqlx) setBusyTimeout(ctx context.Context, ex sqlx.ExtContext) error {
+	if s.SQLiteBusyTimeout <= 0 || ex.DriverName() != "sqlite3" {
+		return nil
+	}
+	_, err := ex.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", s.SQLiteBusyTimeout.Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("setting busy timeout: %w", err)
+	}
+	return nil
+}
+
+// beginTx begins a transaction with opts. The busy timeout is set on each
+// transaction's connection, since busy_timeout applies to a single
+// connection and the pool may hand out a different one each time.
+func (s *Sqlx) beginTx(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions) (*sqlx.Tx, error) {
+	tx, err := db.BeginTxx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	err = s.setBusyTimeout(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// withoutForeignKeys calls fn with a database that uses a single connection
+// from db's pool on which SQLite's foreign key enforcement has been turned
+// off, restoring it afterwards. foreign_keys can't be changed inside of a
+// transaction and only applies to the connection it is set on, so the
+// connection is pinned for as long as fn runs.
+func withoutForeignKeys(ctx context.Context, db *sqlx.DB, fn func(db *sqlx.DB) error) (err error) {
+	conn, err := db.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var enabled bool
+	err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled)
+	if err != nil {
+		return fmt.Errorf("checking foreign keys: %w", err)
+	}
+	_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF")
+	if err != nil {
+		return fmt.Errorf("disabling foreign keys: %w", err)
+	}
+	if enabled {
+		defer func() {
+			// Use a fresh context so that foreign keys are restored even if
+			// ctx was cancelled.
+			_, rerr := conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+			if rerr != nil && err == nil {
+				err = fmt.Errorf("restoring foreign keys: %w", rerr)
+			}
+		}()
+	}
+	return conn.Raw(func(dc interface{}) error {
+		pinned := sql.OpenDB(pinnedConnector{conn: dc.(driver.Conn), driver: db.Driver()})
+		pinned.SetMaxOpenConns(1)
+		defer pinned.Close()
+		return fn(sqlx.NewDb(pinned, db.DriverName()))
+	})
+}
+
+// checkForeignKeys returns an error if PRAGMA foreign_key_check finds any
+// rows that violate a foreign key constraint.
+func checkForeignKeys(ctx context.Context, tx *sqlx.Tx) error {
+	rows, err := tx.QueryContext(ctx, "PRAGMA foreign_key_check")
+	if err != nil {
+		return fmt.Errorf("checking foreign keys: %w", err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		var rowid, fkid sql.NullInt64
+		var parent string
+		err = rows.Scan(&table, &rowid, &parent, &fkid)
+		if err != nil {
+			return fmt.Errorf("checking foreign keys: %w", err)
+		}
+		if !containsString(tables, table) {
+			tables = append(tables, table)
+		}
+	}
+	err = rows.Err()
+	if err != nil {
+		return fmt.Errorf("checking foreign keys: %w", err)
+	}
+	if len(tables) > 0 {
+		return fmt.Errorf("foreign key constraints violated in %q", tables)
+	}
+	return nil
+}
+
+// withForeignKeyCheck returns a copy of m that runs checkForeignKeys after
+// migrating or rolling back, in the same transaction, so that changes made
+// while foreign keys were disabled can't leave dangling references behind.
+func (m SqlxMigration) withForeignKeyCheck() SqlxMigration {
+	orig := m
+	m.Migrate = nil
+	m.MigrateContext = func(ctx context.Context, tx *sqlx.Tx) error {
+		err := orig.migrate(ctx, tx)
+		if err != nil {
+			return err
+		}
+		return checkForeignKeys(ctx, tx)
+	}
+	if orig.Rollback != nil || orig.RollbackContext != nil {
+		m.Rollback = nil
+		m.RollbackContext = func(ctx context.Context, tx *sqlx.Tx) error {
+			err := orig.rollback(ctx, tx)
+			if err != nil {
+				return err
+			}
+			return checkForeignKeys(ctx, tx)
+		}
+	}
+	return m
+}
+
+// pinnedConnector is a driver.Connector that always returns the same
+// connection, used to run a migration through a *sqlx.DB on a connection
+// that has been configured for it.
+type pinnedConnector struct {
+	conn   driver.Conn
+	driver driver.Driver
+}
+
+func (pc pinnedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return pinnedConn{pc.conn}, nil
+}
+
+func (pc pinnedConnector) Driver() driver.Driver {
+	return pc.driver
+}
+
+// pinnedConn wraps a connection that is owned by a database/sql pool. Close
+// is a no-op so that the connection is returned to that pool rather than
+// closed, and the optional interfaces are forwarded so that it behaves like
+// the original.
+type pinnedConn struct {
+	driver.Conn
+}
+
+func (pc pinnedConn) Close() error { return nil }
+
+func (pc pinnedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c, ok := pc.Conn.(driver.ConnBeginTx); ok {
+		return c.BeginTx(ctx, opts)
+	}
+	return pc.Conn.Begin()
+}
+
+func (pc pinnedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if c, ok := pc.Conn.(driver.ConnPrepareContext); ok {
+		return c.PrepareContext(ctx, query)
+	}
+	return pc.Conn.Prepare(query)
+}
+
+func (pc pinnedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if c, ok := pc.Conn.(driver.ExecerContext); ok {
+		return c.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (pc pinnedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if c, ok := pc.Conn.(driver.QueryerContext); ok {
+		return c.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
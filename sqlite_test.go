@@ -0,0 +1,178 @@
+package migrate_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSqlx_SQLite(t *testing.T) {
+	// go-sqlite3 sets a busy timeout by default, so it is turned off to
+	// check that the migrator sets its own.
+	open := func(t *testing.T, path string) *sql.DB {
+		db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=0")
+		if err != nil {
+			t.Fatalf("Open() err = %v; want nil", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	// holdLock starts a write transaction on path and holds it for d.
+	holdLock := func(t *testing.T, path string, d time.Duration) {
+		locker := open(t, path)
+		tx, err := locker.Begin()
+		if err != nil {
+			t.Fatalf("Begin() err = %v; want nil", err)
+		}
+		_, err = tx.Exec("CREATE TABLE held (id int)")
+		if err != nil {
+			t.Fatalf("Exec() err = %v; want nil", err)
+		}
+		go func() {
+			time.Sleep(d)
+			tx.Rollback()
+		}()
+	}
+	newMigrator := func(t *testing.T) migrate.Sqlx {
+		return migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+	}
+
+	t.Run("busy timeout", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db := open(t, path)
+		migrator := newMigrator(t)
+		migrator.SQLiteBusyTimeout = 5 * time.Second
+		holdLock(t, path, 200*time.Millisecond)
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+	})
+
+	t.Run("no busy timeout", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db := open(t, path)
+		migrator := newMigrator(t)
+		holdLock(t, path, 200*time.Millisecond)
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil || !strings.Contains(err.Error(), "locked") {
+			t.Fatalf("Migrate() err = %v; want database is locked", err)
+		}
+	})
+
+	t.Run("wal", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db := open(t, path)
+		migrator := newMigrator(t)
+		migrator.SQLiteWAL = true
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		var mode string
+		err = db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if mode != "wal" {
+			t.Errorf("journal_mode = %q; want %q", mode, "wal")
+		}
+	})
+
+	t.Run("disable foreign keys", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "test.db")
+		db, err := sql.Open("sqlite3", "file:"+path+"?_foreign_keys=1")
+		if err != nil {
+			t.Fatalf("Open() err = %v; want nil", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		// Recreate courses with name changed to NOT NULL. Without disabling
+		// foreign keys, dropping the original courses table would delete
+		// every lesson.
+		rebuild := migrate.SqlxQueryMigration("002_courses_name_not_null", `
+			CREATE TABLE new_courses (id INTEGER PRIMARY KEY, name TEXT NOT NULL);
+			INSERT INTO new_courses (id, name) SELECT id, name FROM courses;
+			DROP TABLE courses;
+			ALTER TABLE new_courses RENAME TO courses;
+		`, "")
+		rebuild.DisableForeignKeys = true
+		migrator := newMigrator(t)
+		migrator.Migrations = []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", `
+				CREATE TABLE courses (id INTEGER PRIMARY KEY, name TEXT);
+				CREATE TABLE lessons (id INTEGER PRIMARY KEY, course_id INTEGER NOT NULL REFERENCES courses (id) ON DELETE CASCADE);
+				INSERT INTO courses (id, name) VALUES (1, 'Algebra');
+				INSERT INTO lessons (id, course_id) VALUES (1, 1), (2, 1);
+			`, ""),
+			rebuild,
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		var lessons int
+		err = db.QueryRow("SELECT COUNT(*) FROM lessons").Scan(&lessons)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if lessons != 2 {
+			t.Errorf("lessons = %d; want 2", lessons)
+		}
+		_, err = db.Exec("INSERT INTO courses (id, name) VALUES (2, NULL)")
+		if err == nil {
+			t.Errorf("Exec() err = nil; want name to be NOT NULL")
+		}
+		// Foreign keys are enforced again on every connection afterwards.
+		for i := 0; i < 3; i++ {
+			_, err = db.Exec("INSERT INTO lessons (course_id) VALUES (99)")
+			if err == nil {
+				t.Fatalf("Exec() err = nil; want a foreign key error")
+			}
+		}
+
+		// Violations found by foreign_key_check fail the migration.
+		dangling := migrate.SqlxQueryMigration("003_dangling_lesson", "INSERT INTO lessons (id, course_id) VALUES (3, 99);", "")
+		dangling.DisableForeignKeys = true
+		migrator.Migrations = append(migrator.Migrations, dangling)
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil || !strings.Contains(err.Error(), "foreign key") {
+			t.Fatalf("Migrate() err = %v; want a foreign key error", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_courses_name_not_null")
+
+		migrator.SingleTransaction = true
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil || !strings.Contains(err.Error(), "DisableForeignKeys") {
+			t.Fatalf("Migrate() err = %v; want an error for SingleTransaction", err)
+		}
+	})
+
+	t.Run("other dialects", func(t *testing.T) {
+		db, fdb := openFake(t)
+		migrator := newMigrator(t)
+		migrator.SQLiteBusyTimeout = 5 * time.Second
+		migrator.SQLiteWAL = true
+		err := migrator.Migrate(db, "postgres")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		for _, stmt := range fdb.Statements() {
+			if strings.Contains(stmt, "PRAGMA") {
+				t.Errorf("statement %q run; want no PRAGMA statements for postgres", stmt)
+			}
+		}
+	})
+}
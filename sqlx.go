@@ -1,122 +1,1590 @@
 package migrate
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"os"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
 
 // Sqlx is a migrator that uses github.com/jmoiron/sqlx
 type Sqlx struct {
+	// Migrations are run in order of their IDs, with runs of digits compared
+	// numerically so that "2_users" is run before "10_widgets". IDs must be
+	// unique.
 	Migrations []SqlxMigration
 	// Printf is used to print out additional information during a migration, such
 	// as which step the migration is currently on. It can be replaced with any
 	// custom printf function, including one that just ignores inputs. If nil it
 	// will default to fmt.Printf.
+	//
+	// Deprecated: Use Logger instead. Printf is only used when Logger is nil.
 	Printf func(format string, a ...interface{}) (n int, err error)
+	// Logger is used to report progress during a migration. If nil, a Logger
+	// that writes to Printf is used.
+	Logger Logger
+	// TableName is the name of the table used to keep track of which
+	// migrations have been run. If empty it will default to "migrations".
+	// Because the table name can't be passed in as a bound parameter it may
+	// only contain letters, numbers, and underscores, optionally qualified
+	// with a schema such as "meta.migrations". See SQLStore.TableName for
+	// details. It is ignored when Store is set.
+	TableName string
+	// IDColumn and NumericIDs configure the column migration IDs are stored
+	// in, defaulting to "id" stored as text. See SQLStore.IDColumn and
+	// SQLStore.NumericIDs for details. They are ignored when Store is set.
+	IDColumn   string
+	NumericIDs bool
+	// AppliedBy is recorded alongside each migration that is run, such as
+	// the version or commit of the application running it, so that it's
+	// possible to tell which build applied a migration. The default Store
+	// keeps it in an applied_by column, which is only added to the
+	// migrations table, and only read back by Status, when AppliedBy is set.
+	// Other Stores are passed it in AppliedMigration.AppliedBy.
+	AppliedBy string
+	// DryRun causes every migration and rollback to be run inside of a
+	// transaction that is rolled back rather than committed, so the
+	// migrations table is never written to. The migrations table isn't
+	// created or altered either, and if it doesn't exist the migrations are
+	// planned as if none had been applied. The SQL of query and file based
+	// migrations is printed as each step is reached.
+	//
+	// Note: DDL is not transactional on every database (eg MySQL), and
+	// migrations that depend on the changes made by an earlier migration in
+	// the same run will likely fail because those changes were rolled back.
+	DryRun bool
+	// AdvisoryLock causes Migrate and Rollback to hold a Postgres session
+	// level advisory lock while they run, so that when several processes try
+	// to migrate the same database at once only one of them runs migrations
+	// and the others wait and then find everything already applied. It is a
+	// no-op for dialects other than Postgres.
+	AdvisoryLock bool
+	// AdvisoryLockKey is the key passed to pg_advisory_lock. If zero,
+	// DefaultAdvisoryLockKey is used.
+	AdvisoryLockKey int64
+	// Locker, if set, is used to acquire a lock before Migrate and Rollback
+	// do any work and to release it once they are done. It takes precedence
+	// over AdvisoryLock. If nil, no lock is used.
+	Locker Locker
+	// StrictOrder causes Migrate to return ErrOutOfOrder rather than run
+	// anything if a pending migration sorts before one that has already been
+	// run. This usually means the pending migration was merged in late, and
+	// without StrictOrder it is simply run after the later migrations.
+	StrictOrder bool
+	// Strict causes Migrate and Rollback to return ErrOrphanedMigration
+	// rather than run anything if a migration recorded as applied isn't one
+	// of the configured Migrations, which usually means it was deleted by
+	// accident. Without Strict orphaned migrations are ignored, though they
+	// are still reported by Status.
+	Strict bool
+	// RequireRollback causes Migrate to return ErrNoRollback, listing the
+	// offending IDs, rather than run anything if any of the configured
+	// Migrations can't be rolled back.
+	RequireRollback bool
+	// RequireMigrations causes Migrate and its variants to return
+	// ErrNoMigrations, before the migrations table is created, if there are
+	// no migrations to run. An empty Migrations slice is usually a mistake,
+	// such as a loader like FSMigrations or GlobMigrations being pointed at
+	// the wrong directory or pattern, which would otherwise look like a
+	// successful run with nothing to do.
+	RequireMigrations bool
+	// BeforeEach, if set, is called before each migration or rollback is
+	// run. If it returns an error the migration is not run and the error is
+	// returned.
+	BeforeEach func(m SqlxMigration) error
+	// AfterEach, if set, is called after each migration or rollback is run
+	// with the error it returned, if any. If AfterEach returns an error it is
+	// returned in place of the original; returning nil does not suppress the
+	// original error.
+	AfterEach func(m SqlxMigration, err error) error
+	// OnStep, if set, is called as soon as each migration or rollback has
+	// been committed or has failed, with how long it took to run and the
+	// error it returned, if any. Unlike MigrateWithResult it reports each
+	// step as it happens, which is useful for spotting slow migrations in
+	// long runs. The duration doesn't include BeforeEach or AfterEach.
+	OnStep func(id string, d time.Duration, err error)
+	// OnEvent, if set, is called for every migration or rollback considered
+	// during a run, including those that are skipped. It is intended for
+	// driving metrics such as counts of applied, skipped, and failed
+	// migrations and a histogram of their durations.
+	OnEvent func(e StepEvent)
+	// Events, if set, is sent a MigrationEvent as each migration or
+	// rollback starts, is skipped, finishes, or fails, which is useful for
+	// showing a run's progress live in an interactive tool. Sends never
+	// block: if the channel isn't ready to receive, the event is dropped, so
+	// use a buffered channel sized for the number of events you expect.
+	// The migrator never closes Events; the caller owns the channel and
+	// may close it once Migrate or Rollback has returned.
+	Events chan<- MigrationEvent
+	// OnComplete, if set, is called by Migrate and its variants once every
+	// migration has succeeded, while any lock is still held. It is a place
+	// to capture a fingerprint of the resulting schema for drift detection,
+	// run ANALYZE, or refresh materialized views. If it returns an error the
+	// call fails with that error, though the migrations remain applied. It
+	// isn't called when DryRun is set.
+	OnComplete func(ctx context.Context, db *sqlx.DB) error
+	// AfterMigrate are maintenance statements, such as ANALYZE, that Migrate
+	// and its variants run in order once every migration has been committed,
+	// if at least one migration was applied. They are run directly on the
+	// database rather than in a transaction, since some can't run in one:
+	// VACUUM can't be run in a transaction on SQLite or Postgres, and on
+	// Postgres VACUUM also can't be run as part of a multi-statement query,
+	// so give each statement its own entry. They are run before OnComplete,
+	// and aren't run when DryRun is set.
+	//
+	// A failing statement is logged and, unless IgnoreAfterMigrateErrors is
+	// set, its error is returned. Either way the migrations remain applied
+	// and the remaining statements aren't run.
+	AfterMigrate []string
+	// IgnoreAfterMigrateErrors causes errors from AfterMigrate statements to
+	// be logged but not returned, so that maintenance failing doesn't fail
+	// an otherwise successful migration.
+	IgnoreAfterMigrateErrors bool
+	// OnProgress, if set, is called by Migrate and its variants after each
+	// pending migration finishes, whether it succeeded or failed, with how
+	// many have finished so far and how many are being run in total. The
+	// total only counts pending migrations, not those already applied, so
+	// it can drive a progress bar. The same counts are included in progress
+	// messages, such as "Running migration (42/200): 042_add_index".
+	OnProgress func(done, total int)
+	// Tracer, if set, is called before each migration or rollback is run
+	// with the context passed to MigrateContext or RollbackContext and the
+	// migration's ID. The context it returns is used to run the migration,
+	// including being passed to MigrateContext and RollbackContext functions,
+	// and the function it returns is called with the result once the
+	// migration finishes. This allows each migration to be wrapped in a
+	// tracing span that is a child of any span in the caller's context
+	// without this package depending on a tracing library.
+	Tracer func(ctx context.Context, id string) (context.Context, func(error))
+	// Now returns the current time. It is used for applied_at, history
+	// events, and the durations in MigrateResult, OnStep, and OnEvent, and
+	// can be replaced to make those deterministic in tests. If nil, time.Now
+	// is used.
+	Now func() time.Time
+	// HistoryTable, if set, is the name of an append-only table that an event
+	// is added to every time a migration or rollback is run, recording the
+	// migration ID, the direction ("up" or "down"), and when it happened. The
+	// migrations table behaves the same either way. HistoryTable is subject to
+	// the same restrictions as TableName.
+	HistoryTable string
+	// Store is used to keep track of which migrations have been run. If nil,
+	// a SQLStore using TableName is used.
+	Store Store
+	// IsApplied, RecordApplied, and RecordRolledBack replace the built-in
+	// bookkeeping with custom functions, for reading and updating migration
+	// state kept by another tool in a table with its own schema. When
+	// IsApplied is set no migrations table is created, IsApplied is called
+	// for each configured migration to find out which have been run, and
+	// RecordApplied and RecordRolledBack are called with the transaction of
+	// each migration and rollback, or the database itself for migrations
+	// with DisableTx set, so that their changes are committed along with it.
+	// RecordApplied is required with IsApplied, while RecordRolledBack is
+	// only needed to roll back. They can't be combined with Store.
+	//
+	// Note: the functions only say whether a migration has been run, so
+	// checksums, applied times, and dirty states aren't kept, and orphaned
+	// migrations can't be detected. A non-transactional migration is only
+	// recorded once it has succeeded.
+	IsApplied        func(db *sqlx.DB, id string) (bool, error)
+	RecordApplied    func(ex sqlx.ExtContext, id string) error
+	RecordRolledBack func(ex sqlx.ExtContext, id string) error
+	// SingleTransaction runs every pending migration, along with recording it
+	// as applied, in one transaction that is committed at the end, so that
+	// if any migration fails none of them are applied. The migrations are
+	// recorded together just before committing; see BatchInserter. It only affects
+	// migrating up, and can't be used with migrations that set DisableTx.
+	//
+	// This should only be used with dialects where DDL is transactional, such
+	// as Postgres. MySQL implicitly commits after most DDL statements, so a
+	// failure partway through can leave some migrations applied but not
+	// recorded. Check that your database supports transactional DDL before
+	// enabling it.
+	SingleTransaction bool
+	// Savepoints changes SingleTransaction so that each migration is run
+	// within a savepoint of the single transaction. If a migration fails
+	// only its own changes are rolled back, to its savepoint, and the
+	// migrations that succeeded before it are committed, after which the
+	// failure is returned. With ContinueOnError the remaining migrations
+	// are run as well before committing. Without Savepoints,
+	// SingleTransaction is all or nothing. It has no effect unless
+	// SingleTransaction is set, and the database must support savepoints,
+	// as Postgres, MySQL, SQLite, and SQL Server do.
+	Savepoints bool
+	// TxOptions, if set, is used when beginning the
+	// transaction each migration or rollback is run in, such as to run
+	// migrations with serializable isolation. A migration's own TxOptions
+	// takes precedence. When SingleTransaction is set only TxOptions on the
+	// Sqlx is used, since every migration shares one transaction. If nil
+	// the driver's defaults are used.
+	//
+	// Note: migrations are recorded as applied in the same transaction, so
+	// a read-only transaction will fail unless DryRun is set.
+	TxOptions *sql.TxOptions
+	// ContinueOnError causes Migrate to keep running the remaining
+	// migrations after one fails rather than stopping, returning every
+	// failure joined together once it is done. Failed migrations aren't
+	// recorded as applied, so they will be retried by the next run. It has
+	// no effect when SingleTransaction is set, unless Savepoints is too.
+	ContinueOnError bool
+	// Retry, if set, causes migrations that fail with an error its
+	// IsRetryable function accepts to be run again in a new transaction.
+	// Rollbacks, migrations with DisableTx set, and migrations run with
+	// SingleTransaction are never retried.
+	Retry *RetryPolicy
+	// SkipTableCreation stops the migrator from creating the migrations
+	// table, or the history table if HistoryTable is set, for setups where
+	// the database user running migrations isn't allowed to. Instead
+	// ErrMissingTable is returned if the migrations table doesn't exist. The
+	// tables must be created ahead of time with:
+	//
+	//	CREATE TABLE migrations (
+	//	  id TEXT PRIMARY KEY,
+	//	  checksum TEXT,
+	//	  applied_at TIMESTAMP,
+	//	  dirty BOOLEAN,
+	//	  description TEXT
+	//	);
+	//	CREATE TABLE migration_history (
+	//	  id TEXT NOT NULL,
+	//	  direction TEXT NOT NULL,
+	//	  applied_at TIMESTAMP NOT NULL
+	//	);
+	//
+	// using TableName and HistoryTable in place of migrations and
+	// migration_history. On MySQL use VARCHAR(255) for id and direction, and
+	// DATETIME(6) for applied_at. On SQL Server use NVARCHAR(255) for id and
+	// direction, NVARCHAR(MAX) for the other text columns, DATETIME2 for
+	// applied_at, and BIT for dirty.
+	SkipTableCreation bool
+	// SQLiteBusyTimeout, if positive, is set as the busy_timeout of the
+	// connections used to run migrations when the dialect is sqlite3, so
+	// that a migration waits up to that long for another connection to
+	// release its lock rather than failing with "database is locked". It
+	// is ignored for other dialects.
+	//
+	// Note: connections to an in-memory database opened with cache=shared,
+	// as this package's tests do, share one cache and lock individual
+	// tables within it, which busy_timeout doesn't apply to. Conflicts
+	// between them fail with "database table is locked" regardless, so use
+	// a file database to test concurrent migrations.
+	SQLiteBusyTimeout time.Duration
+	// SQLiteWAL enables write-ahead logging before migrating when the
+	// dialect is sqlite3, which lets readers keep working while migrations
+	// run. WAL mode is a property of the database file and persists after
+	// the migrator is done. In-memory databases don't support it and keep
+	// their journal mode. It is ignored for other dialects.
+	SQLiteWAL bool
+	// Parallelism is the number of databases MigrateAll and RollbackAll will
+	// work on at once. Values less than 1 are treated as 1. Each database is
+	// worked on with a copy of the migrator, and a PostgresLocker or
+	// MySQLLocker set as Locker is replaced with a new one for each copy,
+	// since they hold onto the connection they locked on. Any other Locker
+	// is shared between the copies, so it must be safe for concurrent use
+	// when Parallelism is greater than 1.
+	Parallelism int
+	// Workers is the number of migrations Migrate will run at once. By
+	// default, or if Workers is less than 2, migrations are run one at a
+	// time in order. Otherwise migrations are run as soon as every migration
+	// listed in their DependsOn has been applied, so migrations that should
+	// run after another must say so. Each migration is still run in its own
+	// transaction, and if one fails no further migrations are started,
+	// though those already running are allowed to finish. BeforeEach,
+	// AfterEach, OnStep, and Tracer may be called concurrently, and
+	// MigrateResult.Applied lists migrations in the order they finished.
+	//
+	// Workers is ignored by MigrateN and when SingleTransaction is set.
+	Workers int
+	// OnlyTags limits the migrator to migrations with at least one of the
+	// provided Tags. Untagged migrations are excluded when it is set. Every
+	// operation, including Migrate, Rollback, and Status, treats excluded
+	// migrations as though they weren't configured, except that excluded
+	// migrations that have been applied aren't considered orphaned.
+	OnlyTags []string
+
+	// AllowReset must be set for Reset to run. It is meant to be enabled
+	// only for databases that are clearly development or test targets, since
+	// Reset rolls back every migration.
+	AllowReset bool
+
+	// DropTableOnEmpty causes the migrations table to be dropped once a
+	// rollback leaves no migrations recorded, so that a database torn down
+	// at the end of a test is left as it was found. It is off by default so
+	// that rolling back doesn't lose the migration history. It applies to
+	// every way of rolling back, but not to dry runs, and is ignored for
+	// Stores that don't implement TableDropper. HistoryTable is never
+	// dropped, since it is meant to outlive rollbacks.
+	DropTableOnEmpty bool
+	// Force allows RollbackID to roll back a migration even though
+	// migrations after it are still applied.
+	Force bool
+
+	// optErrs are errors returned by options passed to NewSqlx.
+	optErrs []error
+}
+
+const defaultTableName = "migrations"
+
+// ErrMigrationNotFound is returned when a migration ID is referenced that
+// isn't one of the migrator's configured Migrations.
+var ErrMigrationNotFound = errors.New("migration not found")
+
+// ErrChecksumMismatch is returned when the SQL of a migration that has
+// already been run doesn't match the SQL that was recorded when it was run,
+// which typically means an applied migration was edited.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// ErrMissingTable is returned when SkipTableCreation is set and the
+// migrations table doesn't exist.
+var ErrMissingTable = errors.New("migrations table does not exist")
+
+// ErrNoRollback is returned when an operation needs to roll back a
+// migration that doesn't provide a rollback.
+var ErrNoRollback = errors.New("migration has no rollback")
+
+// ErrResetNotAllowed is returned by Reset when AllowReset isn't set.
+var ErrResetNotAllowed = errors.New("reset not allowed")
+
+// ErrNoMigrations is returned by Migrate when RequireMigrations is set and
+// there are no migrations to run.
+var ErrNoMigrations = errors.New("no migrations configured")
+
+// ErrNotApplied is returned when an operation needs a migration to have been
+// run but it hasn't been.
+var ErrNotApplied = errors.New("migration not applied")
+
+// ErrLaterMigrationsApplied is returned by RollbackID when migrations after
+// the one being rolled back are still applied and Force isn't set.
+var ErrLaterMigrationsApplied = errors.New("later migrations are applied")
+
+// Directions a migration can be run in.
+const (
+	DirectionUp   = "up"
+	DirectionDown = "down"
+)
+
+// MigrationError is returned when running a migration or rollback fails.
+type MigrationError struct {
+	// ID is the ID of the migration that failed.
+	ID string
+	// Direction is DirectionUp if the migration was being run, or
+	// DirectionDown if it was being rolled back.
+	Direction string
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *MigrationError) Error() string {
+	action := "running migration"
+	if e.Direction == DirectionDown {
+		action = "running rollback"
+	}
+	return fmt.Sprintf("%s %q: %v", action, e.ID, e.Err)
 }
 
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
+
+// ErrDirtyState is returned when a migration that was run outside of a
+// transaction failed partway through, possibly leaving the database in an
+// inconsistent state. Once the database has been repaired, ForceClean can be
+// used to clear the dirty state. Migrations with SqlxMigration.Idempotent set
+// are run again by Migrate instead.
+var ErrDirtyState = errors.New("dirty migration state")
+
+var validTableName = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
 // Migrate will run the migrations using the provided db connection.
 func (s *Sqlx) Migrate(sqlDB *sql.DB, dialect string) error {
+	return s.MigrateContext(context.Background(), sqlDB, dialect)
+}
+
+// MigrateContext will run the migrations using the provided db connection. If
+// the context is cancelled the in-flight migration's transaction is aborted
+// and no further migrations are run.
+func (s *Sqlx) MigrateContext(ctx context.Context, sqlDB *sql.DB, dialect string) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	_, err = s.up(ctx, sqlx.NewDb(sqlDB, dialect), migrations, -1)
+	return err
+}
+
+// MigrateDB will run the migrations using the provided sqlx connection, using
+// its driver name as the dialect.
+func (s *Sqlx) MigrateDB(db *sqlx.DB) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	_, err = s.up(context.Background(), db, migrations, -1)
+	return err
+}
+
+// MigrateResult summarizes what happened during a call to MigrateWithResult.
+type MigrateResult struct {
+	// Applied and Skipped are the IDs of the migrations that were run during
+	// the call and the IDs of the migrations that had already been run
+	// before it, in order. When Workers runs migrations concurrently Applied
+	// is in the order they finished. When SingleTransaction is set and the
+	// transaction is rolled back Applied is empty, since none of them were
+	// kept, but with Savepoints it lists the migrations that were committed.
+	Applied []string
+	Skipped []string
+	// Durations is how long each migration that was run took, keyed by ID. If
+	// a migration failed its duration is included as well.
+	Durations map[string]time.Duration
+	// Duration is how long the entire call took.
+	Duration time.Duration
+	// RowsAffected is the total number of rows affected by the statements of
+	// each migration that was run successfully, keyed by ID, as reported by
+	// the driver. When a file is split into statements their counts are
+	// added together; otherwise it is whatever the driver reports for the
+	// whole file. It is -1 for migrations whose driver doesn't report the
+	// rows affected. Only migrations whose SQL is run by this package, such
+	// as those created by SqlxQueryMigration, SqlxFileMigration, and
+	// FSMigrations, are included.
+	RowsAffected map[string]int64
+}
+
+// WasApplied reports whether the migration with the provided id was run
+// during the call, as opposed to having already been run before it or not
+// being run at all. It is useful for running extra steps, such as
+// invalidating a cache, only when a particular migration has just run.
+func (r MigrateResult) WasApplied(id string) bool {
+	return containsString(r.Applied, id)
+}
+
+// MigrateWithResult will run the migrations using the provided db connection,
+// returning a summary of what was run. If an error occurs the result
+// describes the work done up until that point.
+func (s *Sqlx) MigrateWithResult(sqlDB *sql.DB, dialect string) (MigrateResult, error) {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return MigrateResult{}, err
+	}
+	return s.up(context.Background(), sqlx.NewDb(sqlDB, dialect), migrations, -1)
+}
+
+// MigrateTo will run any pending migrations up to and including the migration
+// with the provided id. If the target migration has already been run this is
+// a no-op. ErrMigrationNotFound is returned if the id isn't one of the
+// configured migrations.
+func (s *Sqlx) MigrateTo(sqlDB *sql.DB, dialect, targetID string) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	i, err := indexOf(migrations, targetID)
+	if err != nil {
+		return err
+	}
+	_, err = s.up(context.Background(), sqlx.NewDb(sqlDB, dialect), migrations[:i+1], -1)
+	return err
+}
+
+// MigrateN will run at most n pending migrations, in order. This is primarily
+// useful when debugging a series of migrations one step at a time. An error is
+// returned if n is not positive.
+func (s *Sqlx) MigrateN(sqlDB *sql.DB, dialect string, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid number of migrations: %d", n)
+	}
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	res, err := s.up(context.Background(), sqlx.NewDb(sqlDB, dialect), migrations, n)
+	count := len(res.Applied)
+	s.log(LevelInfo, fmt.Sprintf("Applied %d of %d requested migrations", count, n), Field{"applied", count}, Field{"requested", n})
+	return err
+}
+
+// Rollback will run all rollbacks using the provided db connection.
+// Migrations are rolled back in the reverse of the order they were applied
+// in, which differs from the reverse of their IDs when a migration was merged
+// in late and run after migrations that sort after it. The same is true of
+// every other method that rolls back more than one migration.
+//
+// With DropTableOnEmpty set, rolling back everything also drops the
+// migrations table, returning the database to the state it was in before
+// any migrations were run. Teardown does the same regardless of
+// DropTableOnEmpty.
+func (s *Sqlx) Rollback(sqlDB *sql.DB, dialect string) error {
+	return s.RollbackContext(context.Background(), sqlDB, dialect)
+}
+
+// RollbackContext will run all rollbacks using the provided db connection. If
+// the context is cancelled the in-flight rollback's transaction is aborted and
+// no further rollbacks are run.
+func (s *Sqlx) RollbackContext(ctx context.Context, sqlDB *sql.DB, dialect string) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	_, err = s.down(ctx, sqlx.NewDb(sqlDB, dialect), migrations, -1)
+	return err
+}
+
+// RollbackDB will run all rollbacks using the provided sqlx connection, using
+// its driver name as the dialect.
+func (s *Sqlx) RollbackDB(db *sqlx.DB) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	_, err = s.down(context.Background(), db, migrations, -1)
+	return err
+}
+
+// RollbackTo will roll back every applied migration that comes after the
+// migration with the provided id, leaving the target migration itself
+// applied. If nothing after the target has been run this is a no-op.
+// ErrMigrationNotFound is returned if the id isn't one of the configured
+// migrations.
+func (s *Sqlx) RollbackTo(sqlDB *sql.DB, dialect, targetID string) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	i, err := indexOf(migrations, targetID)
+	if err != nil {
+		return err
+	}
+	_, err = s.down(context.Background(), sqlx.NewDb(sqlDB, dialect), migrations[i+1:], -1)
+	return err
+}
+
+// RollbackN will roll back at most n applied migrations, starting with the
+// most recent. An error is returned if n is not positive.
+func (s *Sqlx) RollbackN(sqlDB *sql.DB, dialect string, n int) error {
+	if n <= 0 {
+		return fmt.Errorf("invalid number of rollbacks: %d", n)
+	}
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	count, err := s.down(context.Background(), sqlx.NewDb(sqlDB, dialect), migrations, n)
+	s.log(LevelInfo, fmt.Sprintf("Rolled back %d of %d requested migrations", count, n), Field{"rolled_back", count}, Field{"requested", n})
+	return err
+}
+
+// Redo rolls back the migration with the provided id, if it has been run,
+// and then runs it again. Each step is run in its own transaction. This is
+// mostly useful while developing a migration. ErrMigrationNotFound is
+// returned if the id isn't one of the configured migrations, and
+// ErrNoRollback if the migration can't be rolled back.
+func (s *Sqlx) Redo(sqlDB *sql.DB, dialect, id string) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	i, err := indexOf(migrations, id)
+	if err != nil {
+		return err
+	}
+	m := migrations[i : i+1]
+	if m[0].runsOn(dialect) && !m[0].hasRollback() {
+		return m[0].errNoRollback()
+	}
+	ctx := context.Background()
 	db := sqlx.NewDb(sqlDB, dialect)
+	_, err = s.down(ctx, db, m, -1)
+	if err != nil {
+		return err
+	}
+	_, err = s.up(ctx, db, m, -1)
+	return err
+}
+
+// RollbackID rolls back only the migration with the provided id, leaving
+// every other migration as it is. This is useful for undoing a single bad
+// migration, such as one that created the wrong index, without rolling back
+// everything after it.
+//
+// ErrMigrationNotFound is returned if the id isn't one of the configured
+// migrations, ErrNotApplied if it hasn't been run, and ErrNoRollback if it
+// can't be rolled back.
+//
+// Note: Rolling back a migration that later migrations depend on can leave
+// the schema inconsistent with what those migrations expect, and the
+// migration will be run again, out of order, by the next Migrate. Because of
+// this RollbackID returns ErrLaterMigrationsApplied, listing them, if any
+// migrations after id are applied unless Force is set.
+func (s *Sqlx) RollbackID(sqlDB *sql.DB, dialect, id string) error {
+	migrations, applied, err := s.loadStatus(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	i, err := indexOf(migrations, id)
+	if err != nil {
+		return err
+	}
+	m := migrations[i]
+	if _, ok := applied[id]; !ok {
+		return fmt.Errorf("%w: %q", ErrNotApplied, id)
+	}
+	if m.runsOn(dialect) && !m.hasRollback() {
+		return m.errNoRollback()
+	}
+	var later []string
+	for _, lm := range migrations[i+1:] {
+		if _, ok := applied[lm.ID]; ok {
+			later = append(later, lm.ID)
+		}
+	}
+	if len(later) > 0 {
+		if !s.Force {
+			return fmt.Errorf("%w: %q", ErrLaterMigrationsApplied, later)
+		}
+		s.log(LevelInfo, "Forcing rollback with later migrations applied: "+id, Field{"id", id}, Field{"later", later})
+	}
+	db, err := newDB(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	_, err = s.down(context.Background(), db, migrations[i:i+1], -1)
+	return err
+}
+
+// Reset rolls back every applied migration and then runs every migration
+// again, rebuilding the schema from scratch. If the rollback fails Reset
+// stops without migrating. Since this destroys data, Reset returns
+// ErrResetNotAllowed unless AllowReset is set.
+func (s *Sqlx) Reset(sqlDB *sql.DB, dialect string) error {
+	if !s.AllowReset {
+		return ErrResetNotAllowed
+	}
+	err := s.Rollback(sqlDB, dialect)
+	if err != nil {
+		return fmt.Errorf("resetting: %w", err)
+	}
+	err = s.Migrate(sqlDB, dialect)
+	if err != nil {
+		return fmt.Errorf("resetting: %w", err)
+	}
+	return nil
+}
+
+// Teardown rolls back every applied migration and then drops the migrations
+// table, as Rollback does with DropTableOnEmpty set, returning the database
+// to the state it was in before any migrations were run. It is meant for
+// cleaning up after tests. HistoryTable, if set, is left in place.
+func (s *Sqlx) Teardown(sqlDB *sql.DB, dialect string) error {
+	m := *s
+	m.DropTableOnEmpty = true
+	return m.Rollback(sqlDB, dialect)
+}
+
+// SetVersion records every configured migration up to and including the one
+// with the provided id as applied, and every migration after it as not
+// applied, without running any of them. This is an escape hatch for after a
+// database has been repaired by hand. ErrMigrationNotFound is returned if the
+// id isn't one of the configured migrations. With DryRun set the changes are
+// rolled back rather than committed.
+func (s *Sqlx) SetVersion(sqlDB *sql.DB, dialect, id string) (err error) {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	i, err := indexOf(migrations, id)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	db, err := newDB(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		uerr := unlock()
+		if err == nil {
+			err = uerr
+		}
+	}()
+
+	store, err := s.prepare(ctx, db)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx, db, store)
+	if err != nil {
+		return err
+	}
+	errorf := func(err error) error { return fmt.Errorf("setting version: %w", err) }
+	tx, err := s.beginTx(ctx, db, nil)
+	if err != nil {
+		return errorf(err)
+	}
+	for j, m := range migrations {
+		_, ok := applied[m.ID]
+		switch {
+		case j <= i && !ok:
+			s.log(LevelInfo, "Marking migration as applied: "+m.ID, Field{"id", m.ID}, Field{"outcome", "marked applied"})
+			err = s.recordApplied(ctx, tx, store, m, false)
+		case j > i && ok:
+			s.log(LevelInfo, "Marking migration as not applied: "+m.ID, Field{"id", m.ID}, Field{"outcome", "marked not applied"})
+			err = store.Delete(ctx, tx, m.ID)
+		}
+		if err != nil {
+			tx.Rollback()
+			return errorf(err)
+		}
+	}
+	if s.DryRun {
+		s.log(LevelInfo, "Dry run, undoing version change", Field{"dry_run", true})
+		return tx.Rollback()
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errorf(err)
+	}
+	return nil
+}
+
+// ForceClean clears the dirty state of the migration with the provided id,
+// leaving it recorded as applied. It should only be used once the database
+// has been repaired after a non-transactional migration failed partway
+// through. To have the migration run again instead, use ForceClean followed
+// by SetVersion with the ID of the previous migration.
+func (s *Sqlx) ForceClean(sqlDB *sql.DB, dialect, id string) error {
+	ctx := context.Background()
+	db, err := newDB(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	store, err := s.prepare(ctx, db)
+	if err != nil {
+		return err
+	}
+	err = store.SetDirty(ctx, db, id, false)
+	if err != nil {
+		return fmt.Errorf("clearing dirty state: %w", err)
+	}
+	s.log(LevelInfo, "Cleared dirty state: "+id, Field{"id", id})
+	return nil
+}
+
+// checkMigrations returns ErrNoMigrations if migrations is empty, noting
+// when that is because OnlyTags excluded every configured migration.
+func (s *Sqlx) checkMigrations(migrations []SqlxMigration) error {
+	if len(migrations) > 0 {
+		return nil
+	}
+	if len(s.Migrations) > 0 {
+		return fmt.Errorf("%w: none of the %d migrations are tagged %q", ErrNoMigrations, len(s.Migrations), s.OnlyTags)
+	}
+	return ErrNoMigrations
+}
+
+// checkRollbacks returns ErrNoRollback listing every configured migration
+// that can't be rolled back.
+func (s *Sqlx) checkRollbacks() error {
+	var missing, reasons []string
+	for _, m := range s.Migrations {
+		if s.included(m) && !m.hasRollback() {
+			missing = append(missing, m.ID)
+			if m.noRollback != "" {
+				reasons = append(reasons, fmt.Sprintf("%q %s", m.ID, m.noRollback))
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if len(reasons) > 0 {
+		return fmt.Errorf("%w: %q (%s)", ErrNoRollback, missing, strings.Join(reasons, "; "))
+	}
+	return fmt.Errorf("%w: %q", ErrNoRollback, missing)
+}
 
-	s.printf("Creating/checking migrations table...\n")
-	err := s.createMigrationTable(db)
+// resumeDirty removes the records of dirty migrations with Idempotent set
+// from applied so that they are run again, returning a copy of migrations in
+// which they are marked as being resumed.
+func resumeDirty(migrations []SqlxMigration, applied map[string]AppliedMigration) []SqlxMigration {
+	var resumed []SqlxMigration
+	for i, m := range migrations {
+		a, ok := applied[m.ID]
+		if !ok || !a.Dirty || !m.DisableTx || !m.Idempotent {
+			continue
+		}
+		if resumed == nil {
+			resumed = append([]SqlxMigration(nil), migrations...)
+		}
+		resumed[i].resuming = true
+		delete(applied, m.ID)
+	}
+	if resumed == nil {
+		return migrations
+	}
+	return resumed
+}
+
+// checkDirty returns ErrDirtyState if any applied migration is dirty.
+func checkDirty(applied map[string]AppliedMigration) error {
+	for id, a := range applied {
+		if a.Dirty {
+			return fmt.Errorf("%w: %q", ErrDirtyState, id)
+		}
+	}
+	return nil
+}
+
+// up runs any of the provided migrations that haven't been run yet, in order.
+// If limit is non-negative no more than limit migrations will be run.
+func (s *Sqlx) up(ctx context.Context, db *sqlx.DB, migrations []SqlxMigration, limit int) (res MigrateResult, err error) {
+	start := s.now()
+	res.Durations = make(map[string]time.Duration)
+	res.RowsAffected = make(map[string]int64)
+	defer func() {
+		res.Duration = s.now().Sub(start)
+	}()
+
+	err = checkDialect(db.DriverName())
+	if err != nil {
+		return res, err
+	}
+	err = s.prepareSQLite(ctx, db)
+	if err != nil {
+		return res, err
+	}
+	if s.RequireMigrations {
+		err = s.checkMigrations(migrations)
+		if err != nil {
+			return res, err
+		}
+	}
+	if s.RequireRollback {
+		err = s.checkRollbacks()
+		if err != nil {
+			return res, err
+		}
+	}
+	unlock, err := s.lock(ctx, db)
+	if err != nil {
+		return res, err
+	}
+	defer func() {
+		uerr := unlock()
+		if err == nil {
+			err = uerr
+		}
+	}()
+	defer func() {
+		if err == nil {
+			err = s.complete(ctx, db, len(res.Applied))
+		}
+	}()
+
+	store, err := s.prepare(ctx, db)
+	if err != nil {
+		return res, err
+	}
+	store, closeStatements := prepareStatements(ctx, db, store)
+	defer closeStatements()
+	applied, err := s.appliedMigrations(ctx, db, store)
+	if err != nil {
+		return res, err
+	}
+	migrations = resumeDirty(migrations, applied)
+	err = checkDirty(applied)
+	if err != nil {
+		return res, err
+	}
+	if s.Strict {
+		err = s.checkOrphaned(applied)
+		if err != nil {
+			return res, err
+		}
+	}
+	if s.StrictOrder {
+		err = checkOrder(migrations, applied)
+		if err != nil {
+			return res, err
+		}
+	}
+	if s.Workers > 1 && !s.SingleTransaction && limit < 0 {
+		err = s.upParallel(ctx, db, store, migrations, applied, &res)
+		return res, err
+	}
+	var tx *sqlx.Tx
+	var sp savepointStatements
+	var batch *batchStore
+	committed := false
+	if s.SingleTransaction {
+		for _, m := range migrations {
+			if _, ok := applied[m.ID]; !ok && m.DisableTx && m.runsOn(db.DriverName()) {
+				return res, fmt.Errorf("migration %q has DisableTx set and can't be run in a single transaction", m.ID)
+			}
+			if _, ok := applied[m.ID]; !ok && s.foreignKeysDisabled(db, m) {
+				return res, fmt.Errorf("migration %q has DisableForeignKeys set and can't be run in a single transaction", m.ID)
+			}
+		}
+		tx, err = s.beginTx(ctx, db, s.TxOptions)
+		if err != nil {
+			return res, fmt.Errorf("beginning transaction: %w", err)
+		}
+		defer func() {
+			if err != nil && !committed {
+				tx.Rollback()
+				// Nothing was applied once the transaction is rolled back.
+				res.Applied = nil
+				res.RowsAffected = make(map[string]int64)
+			}
+		}()
+		if s.Savepoints {
+			sp = savepointSQL(db.DriverName(), "migrate_step")
+		}
+		batch = &batchStore{Store: store}
+		store = batch
+	}
+	var failed []error
+	done, total := 0, countPending(migrations, applied, limit)
+	for _, m := range migrations {
+		if limit >= 0 && len(res.Applied) >= limit {
+			break
+		}
+		if a, ok := applied[m.ID]; ok {
+			err = s.skip(m, a, &res)
+			if err != nil {
+				return res, err
+			}
+			continue
+		}
+		err = ctx.Err()
+		if err != nil {
+			return res, err
+		}
+		m = s.logRunning(db.DriverName(), m, done, total)
+		if sp.create != "" {
+			_, err = tx.ExecContext(ctx, sp.create)
+			if err != nil {
+				return res, fmt.Errorf("creating savepoint: %w", err)
+			}
+		}
+		var pending int
+		if batch != nil {
+			pending = len(batch.pending)
+		}
+		stepStart := s.now()
+		stepCtx, rows := withRowCounter(ctx)
+		err = s.migrateStep(stepCtx, db, tx, store, m)
+		res.Durations[m.ID] = s.now().Sub(stepStart)
+		done++
+		s.progress(done, total)
+		if err != nil {
+			s.log(LevelError, "Migration failed: "+m.ID, Field{"id", m.ID}, Field{"outcome", "failed"}, Field{"error", err})
+			s.event(StepEvent{ID: m.ID, Direction: DirectionUp, Outcome: OutcomeFailed, Duration: res.Durations[m.ID], Err: err})
+			if sp.rollback != "" {
+				_, rerr := tx.ExecContext(ctx, sp.rollback)
+				if rerr != nil {
+					return res, errors.Join(err, fmt.Errorf("rolling back to savepoint: %w", rerr))
+				}
+				batch.pending = batch.pending[:pending]
+				failed = append(failed, err)
+				if s.ContinueOnError {
+					continue
+				}
+				break
+			}
+			if s.ContinueOnError && tx == nil {
+				failed = append(failed, err)
+				continue
+			}
+			return res, err
+		}
+		if sp.release != "" {
+			_, err = tx.ExecContext(ctx, sp.release)
+			if err != nil {
+				return res, fmt.Errorf("releasing savepoint: %w", err)
+			}
+		}
+		s.event(StepEvent{ID: m.ID, Direction: DirectionUp, Outcome: OutcomeApplied, Duration: res.Durations[m.ID]})
+		res.Applied = append(res.Applied, m.ID)
+		rows.record(&res, m.ID)
+	}
+	if tx != nil {
+		if s.DryRun {
+			s.log(LevelInfo, "Dry run, rolling back migrations", Field{"dry_run", true})
+			return res, errors.Join(append(failed, tx.Rollback())...)
+		}
+		err = batch.flush(ctx, tx)
+		if err != nil {
+			return res, fmt.Errorf("recording migrations: %w", err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return res, fmt.Errorf("committing migrations: %w", err)
+		}
+		committed = true
+	}
+	return res, errors.Join(failed...)
+}
+
+// countPending returns how many of migrations up will run: those that
+// haven't been applied, capped at limit if it is non-negative.
+func countPending(migrations []SqlxMigration, applied map[string]AppliedMigration, limit int) int {
+	n := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.ID]; !ok {
+			n++
+		}
+	}
+	if limit >= 0 && n > limit {
+		n = limit
+	}
+	return n
+}
+
+// logRunning logs that m is about to be run, along with the progress of the
+// run. If m doesn't run on dialect a copy without any SQL is returned so
+// that it is recorded as applied without being run.
+func (s *Sqlx) logRunning(dialect string, m SqlxMigration, done, total int) SqlxMigration {
+	progress := fmt.Sprintf("(%d/%d)", done+1, total)
+	if !m.runsOn(dialect) {
+		s.log(LevelInfo, "Recording migration without running it on "+dialect+" "+progress+": "+m.label(), Field{"id", m.ID}, Field{"outcome", "dialect skipped"})
+		m = m.withoutSQL()
+	} else {
+		s.log(LevelInfo, "Running migration "+progress+": "+m.label(), Field{"id", m.ID}, Field{"outcome", "running"})
+	}
+	s.started(m, DirectionUp)
+	return m
+}
+
+// complete runs the AfterMigrate statements, if any migrations were applied,
+// and then calls OnComplete, if it is set, once a run has succeeded.
+func (s *Sqlx) complete(ctx context.Context, db *sqlx.DB, applied int) error {
+	if s.DryRun {
+		return nil
+	}
+	if applied > 0 {
+		err := s.maintain(ctx, db)
+		if err != nil {
+			return err
+		}
+	}
+	if s.OnComplete == nil {
+		return nil
+	}
+	err := s.OnComplete(ctx, db)
+	if err != nil {
+		return fmt.Errorf("on complete: %w", err)
+	}
+	return nil
+}
+
+// maintain runs the AfterMigrate statements outside of any transaction.
+func (s *Sqlx) maintain(ctx context.Context, db *sqlx.DB) error {
+	for _, query := range s.AfterMigrate {
+		s.log(LevelInfo, "Running maintenance: "+query, Field{"query", query})
+		_, err := db.ExecContext(ctx, query)
+		if err != nil {
+			s.log(LevelError, "Maintenance failed: "+query, Field{"query", query}, Field{"error", err})
+			if s.IgnoreAfterMigrateErrors {
+				return nil
+			}
+			return fmt.Errorf("running maintenance %q: %w", query, err)
+		}
+	}
+	return nil
+}
+
+func (s *Sqlx) progress(done, total int) {
+	if s.OnProgress != nil {
+		s.OnProgress(done, total)
+	}
+}
+
+// skip records that an already applied migration was skipped, returning
+// ErrChecksumMismatch if its SQL has changed since it was run.
+func (s *Sqlx) skip(m SqlxMigration, a AppliedMigration, res *MigrateResult) error {
+	sum := m.checksum()
+	if a.Checksum != "" && sum != "" && a.Checksum != sum {
+		return fmt.Errorf("%w: %q", ErrChecksumMismatch, m.ID)
+	}
+	s.log(LevelInfo, "Skipping migration: "+m.label(), Field{"id", m.ID}, Field{"outcome", "skipped"})
+	s.event(StepEvent{ID: m.ID, Direction: DirectionUp, Outcome: OutcomeSkipped})
+	res.Skipped = append(res.Skipped, m.ID)
+	return nil
+}
+
+// down rolls back any of the provided migrations that have been run, most
+// recently applied first. If limit is non-negative no more than limit
+// migrations will be rolled back. The number of migrations rolled back is
+// returned.
+func (s *Sqlx) down(ctx context.Context, db *sqlx.DB, migrations []SqlxMigration, limit int) (count int, err error) {
+	err = checkDialect(db.DriverName())
+	if err != nil {
+		return 0, err
+	}
+	err = s.prepareSQLite(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := s.lock(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		uerr := unlock()
+		if err == nil {
+			err = uerr
+		}
+	}()
+
+	// Nothing can have been applied if the table doesn't exist, so don't
+	// create it just to find that out. If the check itself fails the table
+	// is prepared as usual, which reports any real problem. With
+	// SkipTableCreation set prepare reports the missing table instead.
+	if missing, err := s.missingTable(ctx, db); err == nil && missing && !s.SkipTableCreation {
+		s.log(LevelInfo, "Migrations table does not exist, nothing to roll back")
+		return 0, nil
+	}
+	store, err := s.prepare(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	store, closeStatements := prepareStatements(ctx, db, store)
+	defer closeStatements()
+	applied, err := s.appliedMigrations(ctx, db, store)
+	if err != nil {
+		return 0, err
+	}
+	err = checkDirty(applied)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	for _, m := range s.Migrations {
-		var found string
-		err := db.Get(&found, "SELECT id FROM migrations WHERE id=$1", m.ID)
-		switch err {
-		case sql.ErrNoRows:
-			s.printf("Running migration: %v\n", m.ID)
-			// we need to run the migration so we continue to code below
-		case nil:
-			s.printf("Skipping migration: %v\n", m.ID)
+	if s.Strict {
+		err = s.checkOrphaned(applied)
+		if err != nil {
+			return 0, err
+		}
+	}
+	migrations = appliedOrder(migrations, applied)
+	for i := len(migrations) - 1; i >= 0; i-- {
+		if limit >= 0 && count >= limit {
+			break
+		}
+		m := migrations[i]
+		if !m.runsOn(db.DriverName()) {
+			m = m.withoutSQL()
+		}
+		if !m.hasRollback() {
+			s.log(LevelInfo, "Rollback not provided: "+m.ID, Field{"id", m.ID}, Field{"outcome", "no rollback"})
+			s.event(StepEvent{ID: m.ID, Direction: DirectionDown, Outcome: OutcomeSkipped})
 			continue
-		default:
-			return fmt.Errorf("looking up migration by id: %w", err)
 		}
-		err = s.runMigration(db, m)
+		if _, ok := applied[m.ID]; !ok {
+			s.log(LevelInfo, "Skipping rollback: "+m.ID, Field{"id", m.ID}, Field{"outcome", "skipped"})
+			s.event(StepEvent{ID: m.ID, Direction: DirectionDown, Outcome: OutcomeSkipped})
+			continue
+		}
+		err = ctx.Err()
 		if err != nil {
-			return err
+			return count, err
+		}
+		s.log(LevelInfo, "Running rollback: "+m.label(), Field{"id", m.ID}, Field{"outcome", "running"})
+		s.started(m, DirectionDown)
+		stepStart := s.now()
+		err = s.rollbackStep(ctx, db, store, m)
+		d := s.now().Sub(stepStart)
+		if err != nil {
+			s.log(LevelError, "Rollback failed: "+m.ID, Field{"id", m.ID}, Field{"outcome", "failed"}, Field{"error", err})
+			s.event(StepEvent{ID: m.ID, Direction: DirectionDown, Outcome: OutcomeFailed, Duration: d, Err: err})
+			return count, err
 		}
+		s.event(StepEvent{ID: m.ID, Direction: DirectionDown, Outcome: OutcomeApplied, Duration: d})
+		count++
 	}
-	return nil
+	if s.DropTableOnEmpty && !s.DryRun {
+		err = s.dropIfEmpty(ctx, db, store)
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
 }
 
-// Rollback will run all rollbacks using the provided db connection.
-func (s *Sqlx) Rollback(sqlDB *sql.DB, dialect string) error {
-	db := sqlx.NewDb(sqlDB, dialect)
-
-	s.printf("Creating/checking migrations table...\n")
-	err := s.createMigrationTable(db)
+// dropIfEmpty drops the migrations table when no migrations are recorded in
+// it.
+func (s *Sqlx) dropIfEmpty(ctx context.Context, db *sqlx.DB, store Store) error {
+	dropper, ok := store.(TableDropper)
+	if !ok {
+		return nil
+	}
+	applied, err := store.Applied(ctx, db)
 	if err != nil {
 		return err
 	}
-	for i := len(s.Migrations) - 1; i >= 0; i-- {
-		m := s.Migrations[i]
-		if m.Rollback == nil {
-			s.printf("Rollback not provided: %v\n", m.ID)
-			continue
+	if len(applied) > 0 {
+		return nil
+	}
+	s.log(LevelInfo, "Dropping empty migrations table...")
+	err = dropper.DropTable(ctx, db)
+	if err != nil {
+		return fmt.Errorf("dropping migrations table: %w", err)
+	}
+	return nil
+}
+
+// prepare ensures the migrations table exists, returning the Store used to
+// keep track of which migrations have been run.
+func (s *Sqlx) prepare(ctx context.Context, db *sqlx.DB) (Store, error) {
+	if len(s.optErrs) > 0 {
+		return nil, errors.Join(s.optErrs...)
+	}
+	if s.HistoryTable != "" && !validTableName.MatchString(s.HistoryTable) {
+		return nil, fmt.Errorf("invalid history table name: %q", s.HistoryTable)
+	}
+	err := s.checkBookkeeping()
+	if err != nil {
+		return nil, err
+	}
+	store := s.store()
+	if s.SkipTableCreation {
+		err := s.checkTableExists(ctx, db, store)
+		if err != nil {
+			return nil, err
 		}
-		var found string
-		err := db.Get(&found, "SELECT id FROM migrations WHERE id=$1", m.ID)
-		switch err {
-		case sql.ErrNoRows:
-			s.printf("Skipping rollback: %v\n", m.ID)
-			continue
-		case nil:
-			s.printf("Running rollback: %v\n", m.ID)
-			// we need to run the rollback so we continue to code below
-		default:
-			return fmt.Errorf("looking up rollback by id: %w", err)
+		return store, nil
+	}
+	if s.DryRun {
+		return s.prepareDryRun(ctx, db, store)
+	}
+	s.log(LevelInfo, "Creating/checking migrations table...")
+	err = store.EnsureTable(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if s.HistoryTable != "" {
+		types := columnTypesFor(db.DriverName())
+		columns := "id " + types.key + " NOT NULL, direction " + types.key + " NOT NULL, applied_at " + types.timestamp + " NOT NULL"
+		_, err = db.ExecContext(ctx, createTableSQL(db.DriverName(), s.HistoryTable, columns))
+		if err != nil && !isAlreadyExists(err) {
+			return nil, fmt.Errorf("creating history table: %w", err)
 		}
-		err = s.runRollback(db, m)
+	}
+	return store, nil
+}
+
+// prepareDryRun returns the Store to use for a dry run without creating or
+// altering any tables. If the Store can report that its table doesn't exist,
+// nothing has been applied, so a Store with no records that ignores writes
+// is returned in its place. Stores that don't implement TableChecker are
+// prepared as usual, since there's no other way to know their table exists.
+func (s *Sqlx) prepareDryRun(ctx context.Context, db *sqlx.DB, store Store) (Store, error) {
+	checker, ok := store.(TableChecker)
+	if !ok {
+		err := store.EnsureTable(ctx, db)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		return store, nil
 	}
-	return nil
+	exists, err := checker.TableExists(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		s.log(LevelInfo, "Migrations table does not exist, planning against an empty database")
+		return emptyStore{}, nil
+	}
+	return store, nil
+}
+
+// missingTable reports whether the Store can tell that its table doesn't
+// exist yet, without creating it. It is false for Stores that don't
+// implement TableChecker.
+func (s *Sqlx) missingTable(ctx context.Context, db *sqlx.DB) (bool, error) {
+	if len(s.optErrs) > 0 {
+		return false, errors.Join(s.optErrs...)
+	}
+	err := s.checkBookkeeping()
+	if err != nil {
+		return false, err
+	}
+	checker, ok := s.store().(TableChecker)
+	if !ok {
+		return false, nil
+	}
+	exists, err := checker.TableExists(ctx, db)
+	if err != nil {
+		return false, err
+	}
+	return !exists, nil
 }
 
-func (s *Sqlx) printf(format string, a ...interface{}) (n int, err error) {
-	printf := s.Printf
-	if printf == nil {
-		printf = fmt.Printf
+// checkTableExists returns ErrMissingTable if the Store can report that its
+// table doesn't exist.
+func (s *Sqlx) checkTableExists(ctx context.Context, db *sqlx.DB, store Store) error {
+	checker, ok := store.(TableChecker)
+	if !ok {
+		return nil
+	}
+	exists, err := checker.TableExists(ctx, db)
+	if err != nil {
+		return err
 	}
-	return printf(format, a...)
+	if !exists {
+		return ErrMissingTable
+	}
+	return nil
 }
 
-func (s *Sqlx) createMigrationTable(db *sqlx.DB) error {
-	_, err := db.Exec("CREATE TABLE IF NOT EXISTS migrations (id TEXT PRIMARY KEY )")
+// prepareStatements prepares the statements used to record migrations when
+// store is the default SQLStore, returning the Store to use in its place
+// along with a function that closes them. Migrate and Rollback use it so that
+// the statements aren't parsed again for every migration. If the driver
+// doesn't support prepared statements store is returned as it is.
+func prepareStatements(ctx context.Context, db *sqlx.DB, store Store) (Store, func()) {
+	st, ok := store.(*SQLStore)
+	if !ok {
+		return store, func() {}
+	}
+	ps, err := st.prepareStatements(ctx, db)
 	if err != nil {
-		return fmt.Errorf("creating migrations table: %w", err)
+		return store, func() {}
+	}
+	return ps, ps.close
+}
+
+// unprepared returns the Store wrapped by store if it was prepared with
+// prepareStatements, for use with a database other than the one the
+// statements were prepared on.
+func unprepared(store Store) Store {
+	if ps, ok := store.(*preparedStore); ok {
+		return ps.SQLStore
+	}
+	return store
+}
+
+// checkBookkeeping returns an error if IsApplied and the related functions
+// are set inconsistently.
+func (s *Sqlx) checkBookkeeping() error {
+	if s.IsApplied == nil {
+		if s.RecordApplied != nil || s.RecordRolledBack != nil {
+			return errors.New("RecordApplied and RecordRolledBack require IsApplied to be set")
+		}
+		return nil
+	}
+	if s.Store != nil {
+		return errors.New("IsApplied can't be used with Store")
+	}
+	if s.RecordApplied == nil {
+		return errors.New("IsApplied requires RecordApplied to be set")
 	}
 	return nil
 }
 
-func (s *Sqlx) runMigration(db *sqlx.DB, m SqlxMigration) error {
-	errorf := func(err error) error { return fmt.Errorf("running migration: %w", err) }
+// store returns the configured Store, a Store using IsApplied and the
+// related functions if they are set, or otherwise a SQLStore using
+// TableName, IDColumn, and NumericIDs, with an applied_by column if
+// AppliedBy is set.
+func (s *Sqlx) store() Store {
+	if s.Store != nil {
+		return s.Store
+	}
+	if s.IsApplied != nil {
+		ids := make([]string, 0, len(s.Migrations))
+		for _, m := range s.Migrations {
+			ids = append(ids, m.ID)
+		}
+		return &funcStore{ids: ids, isApplied: s.IsApplied, recordApplied: s.RecordApplied, recordRolledBack: s.RecordRolledBack}
+	}
+	return &SQLStore{TableName: s.TableName, IDColumn: s.IDColumn, NumericIDs: s.NumericIDs, AppliedByColumn: s.AppliedBy != ""}
+}
 
-	tx, err := db.Beginx()
+// appliedMigrations loads every migration that has already been run with a
+// single query so that we don't need to look each one up individually.
+func (s *Sqlx) appliedMigrations(ctx context.Context, db *sqlx.DB, store Store) (map[string]AppliedMigration, error) {
+	records, err := store.Applied(ctx, db)
 	if err != nil {
-		return errorf(err)
+		return nil, err
+	}
+	applied := make(map[string]AppliedMigration, len(records))
+	for _, rec := range records {
+		applied[rec.ID] = rec
+	}
+	return applied, nil
+}
+
+// recordApplied adds a migration to the Store.
+func (s *Sqlx) recordApplied(ctx context.Context, ex sqlx.ExtContext, store Store, m SqlxMigration, dirty bool) error {
+	return store.Insert(ctx, ex, AppliedMigration{
+		ID:          m.ID,
+		Checksum:    m.checksum(),
+		AppliedAt:   s.now().UTC(),
+		Dirty:       dirty,
+		Description: m.Description,
+		AppliedBy:   s.AppliedBy,
+	})
+}
+
+// migrateStep runs a single migration along with the BeforeEach and AfterEach
+// hooks. If tx is non-nil the migration is run in it rather than in its own
+// transaction.
+func (s *Sqlx) migrateStep(ctx context.Context, db *sqlx.DB, tx *sqlx.Tx, store Store, m SqlxMigration) error {
+	err := s.beforeEach(m)
+	if err != nil {
+		return err
+	}
+	start := s.now()
+	ctx, end := s.trace(ctx, m)
+	if s.foreignKeysDisabled(db, m) && tx == nil {
+		err = withoutForeignKeys(ctx, db, func(db *sqlx.DB) error {
+			return s.runMigrationWithRetry(ctx, db, nil, unprepared(store), m.withForeignKeyCheck())
+		})
+	} else {
+		err = s.runMigrationWithRetry(ctx, db, tx, store, m)
 	}
-	_, err = tx.Exec("INSERT INTO migrations (id) VALUES ($1)", m.ID)
+	end(err)
+	s.onStep(m, s.now().Sub(start), err)
+	return s.afterEach(m, err)
+}
+
+// rollbackStep runs a single rollback along with the BeforeEach and AfterEach
+// hooks.
+func (s *Sqlx) rollbackStep(ctx context.Context, db *sqlx.DB, store Store, m SqlxMigration) error {
+	err := s.beforeEach(m)
+	if err != nil {
+		return err
+	}
+	start := s.now()
+	ctx, end := s.trace(ctx, m)
+	if s.foreignKeysDisabled(db, m) {
+		err = withoutForeignKeys(ctx, db, func(db *sqlx.DB) error {
+			return s.runRollback(ctx, db, unprepared(store), m.withForeignKeyCheck())
+		})
+	} else {
+		err = s.runRollback(ctx, db, store, m)
+	}
+	end(err)
+	s.onStep(m, s.now().Sub(start), err)
+	return s.afterEach(m, err)
+}
+
+// now returns the current time using Now, defaulting to time.Now.
+func (s *Sqlx) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+// trace starts a span for m using Tracer, if it is set.
+func (s *Sqlx) trace(ctx context.Context, m SqlxMigration) (context.Context, func(error)) {
+	if s.Tracer == nil {
+		return ctx, func(error) {}
+	}
+	return s.Tracer(ctx, m.ID)
+}
+
+func (s *Sqlx) onStep(m SqlxMigration, d time.Duration, err error) {
+	if s.OnStep != nil {
+		s.OnStep(m.ID, d, err)
+	}
+}
+
+func (s *Sqlx) beforeEach(m SqlxMigration) error {
+	if s.BeforeEach == nil {
+		return nil
+	}
+	err := s.BeforeEach(m)
+	if err != nil {
+		return fmt.Errorf("before %q: %w", m.ID, err)
+	}
+	return nil
+}
+
+func (s *Sqlx) afterEach(m SqlxMigration, err error) error {
+	if s.AfterEach == nil {
+		return err
+	}
+	hookErr := s.AfterEach(m, err)
+	if hookErr != nil {
+		return fmt.Errorf("after %q: %w", m.ID, hookErr)
+	}
+	return err
+}
+
+// runMigration runs a single migration and records it as applied. If tx is
+// non-nil the migration is run in it and committing is left to the caller.
+func (s *Sqlx) runMigration(ctx context.Context, db *sqlx.DB, tx *sqlx.Tx, store Store, m SqlxMigration) error {
+	errorf := func(err error) error { return &MigrationError{ID: m.ID, Direction: DirectionUp, Err: err} }
+
+	if s.DryRun && m.UpQuery != "" {
+		s.log(LevelInfo, m.UpQuery, Field{"id", m.ID}, Field{"dry_run", true})
+	}
+	if tx != nil {
+		err := s.applyInTx(ctx, tx, store, m)
+		if err != nil {
+			return errorf(err)
+		}
+		return nil
+	}
+	if m.DisableTx {
+		if s.DryRun {
+			s.log(LevelInfo, "Dry run, skipping non-transactional migration: "+m.ID, Field{"id", m.ID}, Field{"dry_run", true})
+			return nil
+		}
+		// Record the migration as dirty before running it so that if it fails
+		// partway through the next run knows the database needs attention.
+		// A migration being resumed is already recorded that way.
+		if c := rowCounterFrom(ctx); c != nil {
+			c.reset()
+		}
+		if m.resuming {
+			s.log(LevelInfo, "Resuming dirty migration: "+m.ID, Field{"id", m.ID}, Field{"outcome", "resuming"})
+		} else {
+			err := s.recordApplied(ctx, db, store, m, true)
+			if err != nil {
+				return errorf(err)
+			}
+		}
+		err := m.exec(ctx, db, m.UpQuery)
+		if err != nil {
+			return errorf(err)
+		}
+		err = store.SetDirty(ctx, db, m.ID, false)
+		if err != nil {
+			return errorf(err)
+		}
+		err = s.recordHistory(ctx, db, m.ID, DirectionUp)
+		if err != nil {
+			return errorf(err)
+		}
+		return nil
+	}
+
+	tx, err := s.beginTx(ctx, db, s.txOptions(m))
 	if err != nil {
-		tx.Rollback()
 		return errorf(err)
 	}
-	err = m.Migrate(tx)
+	err = s.applyInTx(ctx, tx, store, m)
 	if err != nil {
 		tx.Rollback()
 		return errorf(err)
 	}
+	if s.DryRun {
+		s.log(LevelInfo, "Dry run, rolling back migration: "+m.ID, Field{"id", m.ID}, Field{"dry_run", true})
+		return tx.Rollback()
+	}
 	err = tx.Commit()
 	if err != nil {
 		return errorf(err)
@@ -124,19 +1592,92 @@ func (s *Sqlx) runMigration(db *sqlx.DB, m SqlxMigration) error {
 	return nil
 }
 
-func (s *Sqlx) runRollback(db *sqlx.DB, m SqlxMigration) error {
-	errorf := func(err error) error { return fmt.Errorf("running rollback: %w", err) }
+// foreignKeysDisabled reports whether m should be run with SQLite's foreign
+// key enforcement turned off.
+func (s *Sqlx) foreignKeysDisabled(db *sqlx.DB, m SqlxMigration) bool {
+	return m.DisableForeignKeys && db.DriverName() == "sqlite3" && m.runsOn(db.DriverName())
+}
+
+// txOptions returns the options for the transaction m is run in.
+func (s *Sqlx) txOptions(m SqlxMigration) *sql.TxOptions {
+	if m.TxOptions != nil {
+		return m.TxOptions
+	}
+	return s.TxOptions
+}
+
+// applyInTx runs a migration in tx and, unless this is a dry run, records it
+// as applied.
+func (s *Sqlx) applyInTx(ctx context.Context, tx *sqlx.Tx, store Store, m SqlxMigration) error {
+	rows := rowCounterFrom(ctx)
+	if rows != nil {
+		rows.reset()
+	}
+	untrack := m.upStep.track(tx, rows)
+	err := m.migrate(ctx, tx)
+	untrack()
+	if err != nil {
+		return err
+	}
+	if s.DryRun {
+		return nil
+	}
+	err = s.recordApplied(ctx, tx, store, m, false)
+	if err != nil {
+		return err
+	}
+	return s.recordHistory(ctx, tx, m.ID, DirectionUp)
+}
+
+func (s *Sqlx) runRollback(ctx context.Context, db *sqlx.DB, store Store, m SqlxMigration) error {
+	errorf := func(err error) error { return &MigrationError{ID: m.ID, Direction: DirectionDown, Err: err} }
+
+	if s.DryRun && m.DownQuery != "" {
+		s.log(LevelInfo, m.DownQuery, Field{"id", m.ID}, Field{"dry_run", true})
+	}
+	if m.DisableTx {
+		if s.DryRun {
+			s.log(LevelInfo, "Dry run, skipping non-transactional rollback: "+m.ID, Field{"id", m.ID}, Field{"dry_run", true})
+			return nil
+		}
+		err := store.SetDirty(ctx, db, m.ID, true)
+		if err != nil {
+			return errorf(err)
+		}
+		err = m.exec(ctx, db, m.DownQuery)
+		if err != nil {
+			return errorf(err)
+		}
+		err = store.Delete(ctx, db, m.ID)
+		if err != nil {
+			return errorf(err)
+		}
+		err = s.recordHistory(ctx, db, m.ID, DirectionDown)
+		if err != nil {
+			return errorf(err)
+		}
+		return nil
+	}
 
-	tx, err := db.Beginx()
+	tx, err := s.beginTx(ctx, db, s.txOptions(m))
+	if err != nil {
+		return errorf(err)
+	}
+	err = m.rollback(ctx, tx)
 	if err != nil {
+		tx.Rollback()
 		return errorf(err)
 	}
-	_, err = tx.Exec("DELETE FROM migrations WHERE id=$1", m.ID)
+	if s.DryRun {
+		s.log(LevelInfo, "Dry run, undoing rollback: "+m.ID, Field{"id", m.ID}, Field{"dry_run", true})
+		return tx.Rollback()
+	}
+	err = store.Delete(ctx, tx, m.ID)
 	if err != nil {
 		tx.Rollback()
 		return errorf(err)
 	}
-	err = m.Rollback(tx)
+	err = s.recordHistory(ctx, tx, m.ID, DirectionDown)
 	if err != nil {
 		tx.Rollback()
 		return errorf(err)
@@ -148,65 +1689,370 @@ func (s *Sqlx) runRollback(db *sqlx.DB, m SqlxMigration) error {
 	return nil
 }
 
+// recordHistory adds an event to the history table, if there is one.
+// direction should be either "up" or "down".
+func (s *Sqlx) recordHistory(ctx context.Context, ex sqlx.ExtContext, id, direction string) error {
+	if s.HistoryTable == "" || s.DryRun {
+		return nil
+	}
+	_, err := ex.ExecContext(ctx, ex.Rebind("INSERT INTO "+s.HistoryTable+" (id, direction, applied_at) VALUES (?, ?, ?)"), id, direction, s.now().UTC())
+	return err
+}
+
 // SqlxMigration is a unique ID plus a function that uses a sqlx transaction
 // to perform a database migration step.
 //
-// Note: Long term this could have a Rollback field if we wanted to support
-// that.
+// MigrateContext and RollbackContext are context-aware alternatives to
+// Migrate and Rollback. When set they take precedence, and are passed the
+// context provided to MigrateContext or RollbackContext on the migrator so
+// long running migrations can honor cancellation and deadlines.
 type SqlxMigration struct {
 	ID       string
 	Migrate  func(tx *sqlx.Tx) error
 	Rollback func(tx *sqlx.Tx) error
+
+	// Description is an optional human readable summary of what the
+	// migration does. It is included in progress messages and Status, and
+	// recorded in the migrations table when the migration is run.
+	Description string
+
+	MigrateContext  func(ctx context.Context, tx *sqlx.Tx) error
+	RollbackContext func(ctx context.Context, tx *sqlx.Tx) error
+
+	// UpQuery and DownQuery hold the SQL run by migrations created with
+	// helpers like SqlxQueryMigration, SqlxFileMigration, and FSMigrations,
+	// and are used for checksums and dry runs. Unless DisableTx is set they
+	// are informational only; Migrate and Rollback are what actually get
+	// run. They are left empty by SqlxDialectQueryMigration since the SQL
+	// isn't known until the dialect is.
+	UpQuery   string
+	DownQuery string
+
+	// DisableTx causes UpQuery and DownQuery to be run directly against the
+	// database rather than inside of a transaction, which is needed for
+	// statements like CREATE INDEX CONCURRENTLY in Postgres. The Migrate and
+	// Rollback funcs are not used when DisableTx is set, so it is only
+	// supported by SQL based migrations.
+	//
+	// Note: Migrations run this way are not atomic. If one fails partway
+	// through it may leave the database in a partially migrated state that
+	// needs to be repaired by hand. When this happens the migration is
+	// recorded as dirty, and Migrate and Rollback will return ErrDirtyState
+	// until the database is repaired and ForceClean is called, unless
+	// Idempotent is set.
+	DisableTx bool
+
+	// Idempotent declares that a migration with DisableTx set can safely be
+	// run again in full after failing partway through, such as one whose
+	// statements all use IF NOT EXISTS. Rather than returning ErrDirtyState
+	// for it, Migrate runs all of UpQuery again and clears the dirty state
+	// once it succeeds. The migration must be written so that every
+	// statement succeeds whether or not it was run before; the migrator
+	// doesn't ignore any errors on its behalf. Rollback still returns
+	// ErrDirtyState. It has no effect without DisableTx, since transactional
+	// migrations are never left dirty.
+	Idempotent bool
+
+	// OnlyDialects and SkipDialects limit which dialects the migration is run
+	// on, such as a migration that creates a Postgres extension that should
+	// be skipped when tests use sqlite3. Dialects are compared against the
+	// dialect passed to Migrate exactly, so "postgres" doesn't match "pgx".
+	// If OnlyDialects is set the dialect must be in it, and it must not be
+	// in SkipDialects.
+	//
+	// When a migration doesn't run on the current dialect it is still
+	// recorded as applied, without running Migrate or its SQL, so Status
+	// reports it as applied and later migrations can be run in order. Rolling
+	// it back likewise removes the record without running Rollback.
+	OnlyDialects []string
+	SkipDialects []string
+
+	// DependsOn lists the IDs of migrations that must be applied before this
+	// one when Sqlx.Workers allows migrations to run concurrently. It has no
+	// effect when migrations are run one at a time, since every migration
+	// then waits for those before it.
+	DependsOn []string
+
+	// Tags are used with Sqlx.OnlyTags to run a subset of the migrations,
+	// such as skipping those tagged "seed" in production.
+	Tags []string
+
+	// TxOptions, if set, overrides Sqlx.TxOptions for the transaction this
+	// migration and its rollback are run in.
+	TxOptions *sql.TxOptions
+
+	// DisableForeignKeys turns off SQLite's foreign key enforcement while
+	// the migration or its rollback is run, restoring it afterwards. This
+	// is needed to change a table by creating a new one, copying the rows
+	// over, and dropping the original, since dropping a table with foreign
+	// keys enabled deletes or rejects the rows that reference it.
+	// PRAGMA foreign_key_check is run before the migration's transaction is
+	// committed, and any violations it finds fail the migration.
+	//
+	// SQLite ignores changes to foreign_keys inside of a transaction, so it
+	// is changed beforehand on a connection reserved for the migration. As
+	// a result the migration can't be run with SingleTransaction. It is
+	// ignored for dialects other than sqlite3.
+	DisableForeignKeys bool
+
+	// resuming is set when an Idempotent migration left dirty by an earlier
+	// run is being run again.
+	resuming bool
+	// upStep is set for migrations created by the SQL helpers so that Sqlx
+	// can count the rows affected by their Migrate func.
+	upStep *sqlStep
+	// noRollback, if set, explains why the migration has no rollback, such
+	// as a missing down file, and is included in ErrNoRollback errors.
+	noRollback string
+}
+
+// runsOn reports whether the migration should be run on dialect, based on
+// OnlyDialects and SkipDialects.
+func (m SqlxMigration) runsOn(dialect string) bool {
+	if len(m.OnlyDialects) > 0 && !containsString(m.OnlyDialects, dialect) {
+		return false
+	}
+	return !containsString(m.SkipDialects, dialect)
+}
+
+// withoutSQL returns a copy of m that does nothing when it is run or rolled
+// back, for recording migrations that don't run on the current dialect.
+func (m SqlxMigration) withoutSQL() SqlxMigration {
+	noop := func(ctx context.Context, tx *sqlx.Tx) error { return nil }
+	return SqlxMigration{
+		ID:              m.ID,
+		Description:     m.Description,
+		MigrateContext:  noop,
+		RollbackContext: noop,
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// label returns the migration's ID along with its Description, if it has one,
+// for use in progress messages.
+func (m SqlxMigration) label() string {
+	if m.Description == "" {
+		return m.ID
+	}
+	return m.ID + " — " + m.Description
+}
+
+func (m SqlxMigration) migrate(ctx context.Context, tx *sqlx.Tx) error {
+	if m.MigrateContext != nil {
+		return m.MigrateContext(ctx, tx)
+	}
+	return m.Migrate(tx)
+}
+
+// checksum returns a SHA-256 of the migration's UpQuery, or an empty string
+// if the migration doesn't have any SQL to checksum.
+func (m SqlxMigration) checksum() string {
+	if m.UpQuery == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpQuery))
+	return hex.EncodeToString(sum[:])
+}
+
+// errNoRollback returns ErrNoRollback for the migration, along with the
+// reason it has no rollback if one is known.
+func (m SqlxMigration) errNoRollback() error {
+	if m.noRollback != "" {
+		return fmt.Errorf("%w: %q %s", ErrNoRollback, m.ID, m.noRollback)
+	}
+	return fmt.Errorf("%w: %q", ErrNoRollback, m.ID)
+}
+
+func (m SqlxMigration) hasRollback() bool {
+	if m.DisableTx {
+		return m.DownQuery != ""
+	}
+	return m.Rollback != nil || m.RollbackContext != nil
+}
+
+// exec runs the query directly against the database for migrations that
+// have DisableTx set.
+func (m SqlxMigration) exec(ctx context.Context, db *sqlx.DB, query string) error {
+	if query == "" {
+		return fmt.Errorf("migration %q has DisableTx set but no SQL to run", m.ID)
+	}
+	res, err := db.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	if c := rowCounterFrom(ctx); c != nil {
+		c.add(res)
+	}
+	return nil
+}
+
+func (m SqlxMigration) rollback(ctx context.Context, tx *sqlx.Tx) error {
+	if m.RollbackContext != nil {
+		return m.RollbackContext(ctx, tx)
+	}
+	return m.Rollback(tx)
+}
+
+// SqlxFuncMigration will create a SqlxMigration that runs Go code rather than
+// SQL, such as a data transformation that would be awkward to express as a
+// query. up and down are run inside of the migration's transaction and are
+// passed the context provided to MigrateContext or RollbackContext. down may
+// be nil if the migration can't be rolled back.
+//
+// Because there is no SQL to hash, func migrations don't have a checksum and
+// aren't affected by changes to their code.
+func SqlxFuncMigration(id string, up, down func(ctx context.Context, tx *sqlx.Tx) error) SqlxMigration {
+	return SqlxMigration{
+		ID:              id,
+		MigrateContext:  up,
+		RollbackContext: down,
+	}
 }
 
 // SqlxQueryMigration will create a SqlxMigration using the provided id and
 // query string. It is a helper function designed to simplify the process of
 // creating migrations that only depending on a SQL query string.
 func SqlxQueryMigration(id, upQuery, downQuery string) SqlxMigration {
-	queryFn := func(query string) func(tx *sqlx.Tx) error {
+	queryFn := func(query string) sqlExec {
 		if query == "" {
 			return nil
 		}
-		return func(tx *sqlx.Tx) error {
-			_, err := tx.Exec(query)
-			return err
+		return func(tx *sqlx.Tx, rows *rowCounter) error {
+			return execCounted(tx, rows, query)
 		}
 	}
 
 	m := SqlxMigration{
-		ID:       id,
-		Migrate:  queryFn(upQuery),
-		Rollback: queryFn(downQuery),
+		ID:        id,
+		UpQuery:   upQuery,
+		DownQuery: downQuery,
 	}
+	m.upStep = newSQLStep(queryFn(upQuery))
+	m.Migrate = m.upStep.migrate()
+	m.Rollback = sqlRollback(queryFn(downQuery))
 	return m
 }
 
-// SqlxFileMigration will create a SqlxMigration using the provided file.
-func SqlxFileMigration(id, upFile, downFile string) SqlxMigration {
-	fileFn := func(filename string) func(tx *sqlx.Tx) error {
-		if filename == "" {
+// SqlxDialectQueryMigration will create a SqlxMigration using the provided id
+// and queries keyed by dialect. When the migration is run, the query matching
+// the dialect passed to Migrate or Rollback is used, and an error is returned
+// if there isn't one. If down is empty the migration can't be rolled back.
+func SqlxDialectQueryMigration(id string, up, down map[string]string) SqlxMigration {
+	queryFn := func(queries map[string]string) sqlExec {
+		if len(queries) == 0 {
 			return nil
 		}
-		f, err := os.Open(filename)
-		if err != nil {
-			// We could return a migration that errors when the migration is run, but I
-			// think it makes more sense to panic here.
-			panic(err)
+		return func(tx *sqlx.Tx, rows *rowCounter) error {
+			query, ok := queries[tx.DriverName()]
+			if !ok {
+				return fmt.Errorf("migration %q has no SQL for dialect %q", id, tx.DriverName())
+			}
+			return execCounted(tx, rows, query)
+		}
+	}
+
+	m := SqlxMigration{ID: id}
+	m.upStep = newSQLStep(queryFn(up))
+	m.Migrate = m.upStep.migrate()
+	m.Rollback = sqlRollback(queryFn(down))
+	return m
+}
+
+// SqlxFileMigration will create a SqlxMigration using the provided file. It
+// panics if either file can't be read; use SqlxFileMigrationE to handle the
+// error instead.
+func SqlxFileMigration(id, upFile, downFile string, opts ...FileOption) SqlxMigration {
+	m, err := SqlxFileMigrationE(id, upFile, downFile, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// SqlxFileMigrationE will create a SqlxMigration using the provided files,
+// returning an error if either can't be read. The down file is optional and
+// may be an empty string.
+//
+// Files are read when the migration is created rather than when it is run so
+// that the SQL is available for checksums and dry runs. Gzipped files, such as
+// seed.sql.gz, are decompressed when they are read.
+func SqlxFileMigrationE(id, upFile, downFile string, opts ...FileOption) (SqlxMigration, error) {
+	var o fileOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	readFile := func(filename string) (string, error) {
+		if filename == "" {
+			return "", nil
 		}
-		fileBytes, err := ioutil.ReadAll(f)
+		fileBytes, err := ioutil.ReadFile(filename)
 		if err != nil {
-			panic(err)
+			return "", fmt.Errorf("reading migration file: %w", err)
 		}
-		return func(tx *sqlx.Tx) error {
-			_, err := tx.Exec(string(fileBytes))
-			return err
+		return decodeSQL(filename, fileBytes)
+	}
+	fileFn := func(filename, query string) sqlExec {
+		if filename == "" {
+			return nil
+		}
+		return func(tx *sqlx.Tx, rows *rowCounter) error {
+			return execStatements(tx, rows, query, o.splitStatements)
 		}
 	}
 
+	upQuery, err := readFile(upFile)
+	if err != nil {
+		return SqlxMigration{}, err
+	}
+	downQuery, err := readFile(downFile)
+	if err != nil {
+		return SqlxMigration{}, err
+	}
 	m := SqlxMigration{
-		ID:       id,
-		Migrate:  fileFn(upFile),
-		Rollback: fileFn(downFile),
+		ID:        id,
+		UpQuery:   upQuery,
+		DownQuery: downQuery,
 	}
-	return m
+	m.upStep = newSQLStep(fileFn(upFile, upQuery))
+	m.Migrate = m.upStep.migrate()
+	m.Rollback = sqlRollback(fileFn(downFile, downQuery))
+	return m, nil
+}
+
+// SqlxReaderMigration will create a SqlxMigration using SQL read from the
+// provided readers, for migrations fetched from somewhere other than the
+// filesystem such as object storage or a config service. The down reader is
+// optional and may be nil, in which case the migration can't be rolled back.
+//
+// Both readers are read to the end when the migration is created, not when
+// it is run, so they can be closed as soon as SqlxReaderMigration returns.
+// Gzipped contents are decompressed.
+func SqlxReaderMigration(id string, up, down io.Reader) (SqlxMigration, error) {
+	read := func(r io.Reader) (string, error) {
+		if r == nil {
+			return "", nil
+		}
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return "", fmt.Errorf("reading migration %q: %w", id, err)
+		}
+		return decodeSQL(id, b)
+	}
+	upQuery, err := read(up)
+	if err != nil {
+		return SqlxMigration{}, err
+	}
+	downQuery, err := read(down)
+	if err != nil {
+		return SqlxMigration{}, err
+	}
+	return SqlxQueryMigration(id, upQuery, downQuery), nil
 }
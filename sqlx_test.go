@@ -1,10 +1,21 @@
 package migrate_test
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
 
+	"github.com/jmoiron/sqlx"
 	"github.com/joncalhoun/migrate"
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -132,31 +143,2225 @@ func TestSqlx(t *testing.T) {
 			t.Fatalf("Rollback() err = %v; want nil", err)
 		}
 		var count int
-		err = db.QueryRow("SELECT COUNT(id) FROM courses;").Scan(&count)
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'courses'").Scan(&count)
+		if err != nil {
+			t.Fatalf("db.QueryRow() err = %v; want nil", err)
+		}
+		if count != 0 {
+			t.Fatalf("courses table exists after rollback; want it dropped")
+		}
+		// Don't want to test inner workings of lib, so let's just migrate again and verify we have a table now
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ($1) ", "cor_test")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		err = db.QueryRow("SELECT COUNT(*) FROM courses;").Scan(&count)
+		if err != nil {
+			// Want an error here
+			t.Fatalf("db.QueryRow() err = %v; want nil", err)
+		}
+		if count != 1 {
+			t.Fatalf("count = %d; want %d", count, 1)
+		}
+	})
+
+	t.Run("table name", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, ""),
+			},
+			TableName: "billing_migrations",
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		var id string
+		err = db.QueryRow("SELECT id FROM billing_migrations").Scan(&id)
+		if err != nil {
+			t.Fatalf("db.QueryRow() err = %v; want nil", err)
+		}
+		if id != "001_create_courses" {
+			t.Fatalf("id = %q; want %q", id, "001_create_courses")
+		}
+	})
+
+	t.Run("invalid table name", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, ""),
+			},
+			TableName: "migrations; DROP TABLE users",
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want invalid table name error")
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Rollback() err = nil; want invalid table name error")
+		}
+	})
+
+	// SQLite understands both ? and $1 style placeholders, so we can use it to
+	// verify the bookkeeping queries are rebound correctly for other dialects.
+	for _, dialect := range []string{"mysql", "postgres"} {
+		t.Run("bind type "+dialect, func(t *testing.T) {
+			db := sqliteInMem(t)
+			var ran int
+			migrator := migrate.Sqlx{
+				Printf: func(format string, args ...interface{}) (int, error) {
+					t.Logf(format, args...)
+					return 0, nil
+				},
+				Migrations: []migrate.SqlxMigration{
+					{
+						ID: "001_count",
+						Migrate: func(tx *sqlx.Tx) error {
+							ran++
+							return nil
+						},
+						Rollback: func(tx *sqlx.Tx) error {
+							ran--
+							return nil
+						},
+					},
+				},
+			}
+			for i := 0; i < 2; i++ {
+				err := migrator.Migrate(db, dialect)
+				if err != nil {
+					t.Fatalf("Migrate() err = %v; want nil", err)
+				}
+			}
+			if ran != 1 {
+				t.Fatalf("ran = %d; want %d", ran, 1)
+			}
+			err := migrator.Rollback(db, dialect)
+			if err != nil {
+				t.Fatalf("Rollback() err = %v; want nil", err)
+			}
+			if ran != 0 {
+				t.Fatalf("ran = %d; want %d", ran, 0)
+			}
+		})
+	}
+
+	t.Run("context cancelled", func(t *testing.T) {
+		db := sqliteInMem(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var ran []string
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				{
+					ID: "001_cancel",
+					MigrateContext: func(ctx context.Context, tx *sqlx.Tx) error {
+						ran = append(ran, "001_cancel")
+						cancel()
+						return ctx.Err()
+					},
+				},
+				{
+					ID: "002_never",
+					MigrateContext: func(ctx context.Context, tx *sqlx.Tx) error {
+						ran = append(ran, "002_never")
+						return nil
+					},
+				},
+			},
+		}
+		err := migrator.MigrateContext(ctx, db, "sqlite3")
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("MigrateContext() err = %v; want %v", err, context.Canceled)
+		}
+		if len(ran) != 1 {
+			t.Fatalf("ran = %v; want only 001_cancel", ran)
+		}
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM migrations").Scan(&count)
+		if err != nil {
+			t.Fatalf("db.QueryRow() err = %v; want nil", err)
+		}
+		if count != 0 {
+			t.Fatalf("count = %d; want %d", count, 0)
+		}
+	})
+
+	t.Run("migrate to and rollback to", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxFileMigration("003_create_widgets", "testdata/widgets.sql", "testdata/widgets.down.sql"),
+			},
+		}
+		err := migrator.MigrateTo(db, "sqlite3", "002_create_users")
+		if err != nil {
+			t.Fatalf("MigrateTo() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+		err = migrator.MigrateTo(db, "sqlite3", "002_create_users")
+		if err != nil {
+			t.Fatalf("MigrateTo() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+		err = migrator.MigrateTo(db, "sqlite3", "999_missing")
+		if !errors.Is(err, migrate.ErrMigrationNotFound) {
+			t.Fatalf("MigrateTo() err = %v; want %v", err, migrate.ErrMigrationNotFound)
+		}
+
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		err = migrator.RollbackTo(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("RollbackTo() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+		err = migrator.RollbackTo(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("RollbackTo() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+		err = migrator.RollbackTo(db, "sqlite3", "999_missing")
+		if !errors.Is(err, migrate.ErrMigrationNotFound) {
+			t.Fatalf("RollbackTo() err = %v; want %v", err, migrate.ErrMigrationNotFound)
+		}
+	})
+
+	t.Run("migrate n and rollback n", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxFileMigration("003_create_widgets", "testdata/widgets.sql", "testdata/widgets.down.sql"),
+			},
+		}
+		err := migrator.MigrateN(db, "sqlite3", 1)
+		if err != nil {
+			t.Fatalf("MigrateN() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+		err = migrator.MigrateN(db, "sqlite3", 5)
+		if err != nil {
+			t.Fatalf("MigrateN() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users", "003_create_widgets")
+		err = migrator.RollbackN(db, "sqlite3", 2)
+		if err != nil {
+			t.Fatalf("RollbackN() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+
+		for _, n := range []int{0, -1} {
+			err = migrator.MigrateN(db, "sqlite3", n)
+			if err == nil {
+				t.Errorf("MigrateN(%d) err = nil; want error", n)
+			}
+			err = migrator.RollbackN(db, "sqlite3", n)
+			if err == nil {
+				t.Errorf("RollbackN(%d) err = nil; want error", n)
+			}
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var out strings.Builder
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return fmt.Fprintf(&out, format, args...)
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+			DryRun:       true,
+			HistoryTable: "migration_history",
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		if !strings.Contains(out.String(), createCoursesSql) {
+			t.Errorf("output = %q; want it to contain %q", out.String(), createCoursesSql)
+		}
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 0 {
+			t.Errorf("tables = %d; want a dry run to create none", n)
+		}
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ($1) ", "cor_test")
+		if err == nil {
+			t.Fatalf("db.Exec() err = nil; want table missing error")
+		}
+
+		migrator.DryRun = false
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		migrator.DryRun = true
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ($1) ", "cor_test")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+	})
+
+	t.Run("checksum mismatch", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, ""),
+				{
+					ID:      "002_go_func",
+					Migrate: func(tx *sqlx.Tx) error { return nil },
+				},
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+
+		migrator.Migrations[0] = migrate.SqlxQueryMigration("001_create_courses", createUsersSql, "")
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrChecksumMismatch) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrChecksumMismatch)
+		}
+		if !strings.Contains(err.Error(), "001_create_courses") {
+			t.Errorf("Migrate() err = %v; want it to include the migration ID", err)
+		}
+	})
+
+	t.Run("legacy migrations table", func(t *testing.T) {
+		db := sqliteInMem(t)
+		_, err := db.Exec("CREATE TABLE migrations (id TEXT PRIMARY KEY )")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		_, err = db.Exec("INSERT INTO migrations (id) VALUES ('001_create_courses')")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, ""),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, ""),
+			},
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+	})
+
+	// SQLite doesn't support CREATE INDEX CONCURRENTLY, but like it VACUUM
+	// can't be run inside of a transaction.
+	t.Run("disable tx", func(t *testing.T) {
+		db := sqliteInMem(t)
+		vacuum := migrate.SqlxQueryMigration("002_vacuum", "VACUUM", "VACUUM")
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				vacuum,
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want an error running VACUUM in a transaction")
+		}
+		assertApplied(t, db, "001_create_courses")
+
+		vacuum.DisableTx = true
+		migrator.Migrations[1] = vacuum
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_vacuum")
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db)
+	})
+
+	t.Run("file errors", func(t *testing.T) {
+		for name, files := range map[string][2]string{
+			"missing up file":    {"testdata/missing.sql", ""},
+			"missing down file":  {"testdata/widgets.sql", "testdata/missing.sql"},
+			"unreadable up file": {"testdata", ""},
+		} {
+			_, err := migrate.SqlxFileMigrationE("001_create_widgets", files[0], files[1])
+			if err == nil {
+				t.Errorf("%s: SqlxFileMigrationE() err = nil; want error", name)
+			}
+		}
+
+		defer func() {
+			if recover() == nil {
+				t.Errorf("SqlxFileMigration() did not panic; want panic")
+			}
+		}()
+		migrate.SqlxFileMigration("001_create_widgets", "testdata/missing.sql", "")
+	})
+
+	t.Run("sorted by id", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var ran []string
+		record := func(id string) migrate.SqlxMigration {
+			return migrate.SqlxMigration{
+				ID: id,
+				Migrate: func(tx *sqlx.Tx) error {
+					ran = append(ran, id)
+					return nil
+				},
+			}
+		}
+		migrations := []migrate.SqlxMigration{record("10_c"), record("2_b"), record("001_a")}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: migrations,
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		want := []string{"001_a", "2_b", "10_c"}
+		if fmt.Sprint(ran) != fmt.Sprint(want) {
+			t.Fatalf("ran = %v; want %v", ran, want)
+		}
+		if migrations[0].ID != "10_c" {
+			t.Fatalf("Migrations were reordered in place; want original order untouched")
+		}
+	})
+
+	t.Run("duplicate id", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrDuplicateID) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrDuplicateID)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrDuplicateID) {
+			t.Fatalf("Rollback() err = %v; want %v", err, migrate.ErrDuplicateID)
+		}
+	})
+
+	t.Run("strict order", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxFileMigration("003_create_widgets", "testdata/widgets.sql", "testdata/widgets.down.sql"),
+			},
+			StrictOrder: true,
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+
+		// 002 was merged after 003 had already been run.
+		migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql))
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrOutOfOrder) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrOutOfOrder)
+		}
+		for _, id := range []string{"002_create_users", "003_create_widgets"} {
+			if !strings.Contains(err.Error(), id) {
+				t.Errorf("Migrate() err = %v; want it to mention %q", err, id)
+			}
+		}
+		assertApplied(t, db, "001_create_courses", "003_create_widgets")
+
+		migrator.StrictOrder = false
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users", "003_create_widgets")
+
+		// Applied migrations excluded by OnlyTags or no longer configured
+		// don't make earlier pending ones out of order.
+		seed := migrate.SqlxQueryMigration("005_seed", "SELECT 1;", "SELECT 1;")
+		seed.Tags = []string{"seed"}
+		migrator.Migrations = append(migrator.Migrations, seed)
+		_, err = db.Exec("INSERT INTO migrations (id) VALUES ('006_removed')")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		noop := migrate.SqlxQueryMigration("004_noop", "SELECT 1;", "SELECT 1;")
+		noop.Tags = []string{"schema"}
+		migrator.Migrations = append(migrator.Migrations, noop)
+		migrator.OnlyTags = []string{"schema"}
+		migrator.StrictOrder = true
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users", "003_create_widgets", "004_noop", "005_seed", "006_removed")
+	})
+
+	t.Run("result", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql))
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if fmt.Sprint(res.Applied) != "[002_create_users]" {
+			t.Errorf("Applied = %v; want [002_create_users]", res.Applied)
+		}
+		if fmt.Sprint(res.Skipped) != "[001_create_courses]" {
+			t.Errorf("Skipped = %v; want [001_create_courses]", res.Skipped)
+		}
+		if !res.WasApplied("002_create_users") || res.WasApplied("001_create_courses") {
+			t.Errorf("WasApplied() = %t, %t; want true for 002_create_users only", res.WasApplied("002_create_users"), res.WasApplied("001_create_courses"))
+		}
+		if _, ok := res.Durations["002_create_users"]; !ok || len(res.Durations) != 1 {
+			t.Errorf("Durations = %v; want only 002_create_users", res.Durations)
+		}
+		if res.Duration < res.Durations["002_create_users"] {
+			t.Errorf("Duration = %v; want at least %v", res.Duration, res.Durations["002_create_users"])
+		}
+	})
+
+	t.Run("hooks", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var calls []string
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_broken", "NOT VALID SQL", ""),
+				migrate.SqlxQueryMigration("003_create_users", createUsersSql, dropUsersSql),
+			},
+			BeforeEach: func(m migrate.SqlxMigration) error {
+				calls = append(calls, "before "+m.ID)
+				return nil
+			},
+			AfterEach: func(m migrate.SqlxMigration, err error) error {
+				calls = append(calls, fmt.Sprintf("after %s err=%t", m.ID, err != nil))
+				return nil
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want error")
+		}
+		want := []string{
+			"before 001_create_courses",
+			"after 001_create_courses err=false",
+			"before 002_broken",
+			"after 002_broken err=true",
+		}
+		if fmt.Sprint(calls) != fmt.Sprint(want) {
+			t.Fatalf("calls = %v; want %v", calls, want)
+		}
+
+		errVeto := errors.New("vetoed")
+		migrator.Migrations = migrator.Migrations[2:]
+		migrator.BeforeEach = func(m migrate.SqlxMigration) error {
+			return errVeto
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, errVeto) {
+			t.Fatalf("Migrate() err = %v; want %v", err, errVeto)
+		}
+		assertApplied(t, db, "001_create_courses")
+	})
+
+	t.Run("set version", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxFileMigration("003_create_widgets", "testdata/widgets.sql", "testdata/widgets.down.sql"),
+			},
+		}
+		err := migrator.SetVersion(db, "sqlite3", "002_create_users")
+		if err != nil {
+			t.Fatalf("SetVersion() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+		// Nothing should have actually been run.
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ($1) ", "cor_test")
+		if err == nil {
+			t.Fatalf("db.Exec() err = nil; want table missing error")
+		}
+
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		migrator.DryRun = true
+		err = migrator.SetVersion(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("SetVersion() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users", "003_create_widgets")
+		migrator.DryRun = false
+		err = migrator.SetVersion(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("SetVersion() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+
+		err = migrator.SetVersion(db, "sqlite3", "999_missing")
+		if !errors.Is(err, migrate.ErrMigrationNotFound) {
+			t.Fatalf("SetVersion() err = %v; want %v", err, migrate.ErrMigrationNotFound)
+		}
+	})
+
+	t.Run("dirty state", func(t *testing.T) {
+		db := sqliteInMem(t)
+		broken := migrate.SqlxQueryMigration("002_broken", "CREATE TABLE users (id int); NOT VALID SQL", "")
+		broken.DisableTx = true
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				broken,
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want error")
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrDirtyState) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrDirtyState)
+		}
+		if !strings.Contains(err.Error(), "002_broken") {
+			t.Errorf("Migrate() err = %v; want it to mention 002_broken", err)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrDirtyState) {
+			t.Fatalf("Rollback() err = %v; want %v", err, migrate.ErrDirtyState)
+		}
+
+		err = migrator.ForceClean(db, "sqlite3", "002_broken")
+		if err != nil {
+			t.Fatalf("ForceClean() err = %v; want nil", err)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_broken")
+
+		err = migrator.ForceClean(db, "sqlite3", "999_missing")
+		if !errors.Is(err, migrate.ErrMigrationNotFound) {
+			t.Fatalf("ForceClean() err = %v; want %v", err, migrate.ErrMigrationNotFound)
+		}
+	})
+
+	t.Run("resume idempotent dirty migration", func(t *testing.T) {
+		db := sqliteInMem(t)
+		// The index fails until categories exists, leaving lessons created.
+		lessons := migrate.SqlxQueryMigration("002_create_lessons", `
+			CREATE TABLE IF NOT EXISTS lessons (id int, category_id int);
+			CREATE INDEX IF NOT EXISTS lessons_category ON categories (id);`, "")
+		lessons.DisableTx = true
+		lessons.Idempotent = true
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				lessons,
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want error")
+		}
+		statuses, err := migrator.Status(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Status() err = %v; want nil", err)
+		}
+		if !statuses[1].Dirty {
+			t.Fatalf("Status()[1].Dirty = false; want true")
+		}
+
+		_, err = db.Exec("CREATE TABLE categories (id int)")
+		if err != nil {
+			t.Fatalf("Exec() err = %v; want nil", err)
+		}
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if !res.WasApplied("002_create_lessons") {
+			t.Errorf("MigrateWithResult() Applied = %v; want 002_create_lessons resumed", res.Applied)
+		}
+		statuses, err = migrator.Status(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Status() err = %v; want nil", err)
+		}
+		if statuses[1].Dirty {
+			t.Errorf("Status()[1].Dirty = true; want the dirty state cleared")
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_lessons")
+	})
+
+	t.Run("history table", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+			HistoryTable: "migration_history",
+		}
+		for i := 0; i < 2; i++ {
+			err := migrator.Migrate(db, "sqlite3")
+			if err != nil {
+				t.Fatalf("Migrate() err = %v; want nil", err)
+			}
+			err = migrator.Rollback(db, "sqlite3")
+			if err != nil {
+				t.Fatalf("Rollback() err = %v; want nil", err)
+			}
+		}
+		rows, err := db.Query("SELECT id, direction FROM migration_history ORDER BY rowid")
+		if err != nil {
+			t.Fatalf("db.Query() err = %v; want nil", err)
+		}
+		defer rows.Close()
+		var got []string
+		for rows.Next() {
+			var id, direction string
+			err = rows.Scan(&id, &direction)
+			if err != nil {
+				t.Fatalf("rows.Scan() err = %v; want nil", err)
+			}
+			got = append(got, id+" "+direction)
+		}
+		want := []string{
+			"001_create_courses up",
+			"001_create_courses down",
+			"001_create_courses up",
+			"001_create_courses down",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("history = %v; want %v", got, want)
+		}
+		assertApplied(t, db)
+	})
+
+	t.Run("dialect queries", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxDialectQueryMigration("001_create_courses",
+					map[string]string{
+						"sqlite3":  createCoursesSql,
+						"postgres": "CREATE TABLE courses (id SERIAL PRIMARY KEY, name TEXT);",
+					},
+					map[string]string{
+						"sqlite3":  dropCoursesSql,
+						"postgres": dropCoursesSql,
+					}),
+			},
+		}
+		err := migrator.Migrate(db, "mysql")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want an error")
+		}
+		if !strings.Contains(err.Error(), "001_create_courses") || !strings.Contains(err.Error(), "mysql") {
+			t.Errorf("Migrate() err = %v; want it to name the migration and dialect", err)
+		}
+		assertApplied(t, db)
+
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ('Gophercises')")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db)
+	})
+
+	t.Run("single transaction", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxQueryMigration("003_broken", "NOT VALID SQL", ""),
+			},
+			SingleTransaction: true,
+		}
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("MigrateWithResult() err = nil; want an error")
+		}
+		if len(res.Applied) != 0 {
+			t.Errorf("Applied = %v; want none", res.Applied)
+		}
+		assertApplied(t, db)
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ('Gophercises')")
+		if err == nil {
+			t.Fatalf("db.Exec() err = nil; want an error since courses should have been rolled back")
+		}
+
+		migrator.Migrations = migrator.Migrations[:2]
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+	})
+
+	t.Run("unsupported dialect", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+		err := migrator.Migrate(db, "sqlite")
+		if !errors.Is(err, migrate.ErrUnsupportedDialect) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrUnsupportedDialect)
+		}
+		if !strings.Contains(err.Error(), `"sqlite"`) || !strings.Contains(err.Error(), "sqlite3") {
+			t.Errorf("Migrate() err = %v; want it to name the dialect and list supported ones", err)
+		}
+		err = migrator.Rollback(db, "sqlite")
+		if !errors.Is(err, migrate.ErrUnsupportedDialect) {
+			t.Fatalf("Rollback() err = %v; want %v", err, migrate.ErrUnsupportedDialect)
+		}
+	})
+
+	t.Run("migration error", func(t *testing.T) {
+		db := sqliteInMem(t)
+		errBoom := errors.New("boom")
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				{
+					ID:       "002_broken",
+					Migrate:  func(tx *sqlx.Tx) error { return nil },
+					Rollback: func(tx *sqlx.Tx) error { return errBoom },
+				},
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		var merr *migrate.MigrationError
+		if !errors.As(err, &merr) {
+			t.Fatalf("Rollback() err = %v; want a *MigrationError", err)
+		}
+		if merr.ID != "002_broken" || merr.Direction != migrate.DirectionDown {
+			t.Errorf("MigrationError = {%q, %q}; want {%q, %q}", merr.ID, merr.Direction, "002_broken", migrate.DirectionDown)
+		}
+		if !errors.Is(err, errBoom) {
+			t.Errorf("Rollback() err = %v; want it to wrap %v", err, errBoom)
+		}
+		assertApplied(t, db, "001_create_courses", "002_broken")
+	})
+
+	t.Run("redo", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var runs int
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				{
+					ID: "002_count",
+					Migrate: func(tx *sqlx.Tx) error {
+						runs++
+						return nil
+					},
+				},
+				{
+					ID:           "003_postgres_only",
+					OnlyDialects: []string{"postgres"},
+					Migrate: func(tx *sqlx.Tx) error {
+						return nil
+					},
+				},
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ('Gophercises')")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		err = migrator.Redo(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("Redo() err = %v; want nil", err)
+		}
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM courses").Scan(&count)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if count != 0 {
+			t.Errorf("count = %d; want 0 since the table should have been recreated", count)
+		}
+		assertApplied(t, db, "001_create_courses", "002_count", "003_postgres_only")
+
+		// Migrations skipped for the dialect don't need a rollback.
+		err = migrator.Redo(db, "sqlite3", "003_postgres_only")
+		if err != nil {
+			t.Fatalf("Redo() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_count", "003_postgres_only")
+
+		err = migrator.Redo(db, "sqlite3", "002_count")
+		if !errors.Is(err, migrate.ErrNoRollback) {
+			t.Fatalf("Redo() err = %v; want %v", err, migrate.ErrNoRollback)
+		}
+		if runs != 1 {
+			t.Errorf("runs = %d; want 1", runs)
+		}
+		err = migrator.Redo(db, "sqlite3", "004_missing")
+		if !errors.Is(err, migrate.ErrMigrationNotFound) {
+			t.Fatalf("Redo() err = %v; want %v", err, migrate.ErrMigrationNotFound)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ('Gophercises')")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		err = migrator.Reset(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrResetNotAllowed) {
+			t.Fatalf("Reset() err = %v; want %v", err, migrate.ErrResetNotAllowed)
+		}
+
+		migrator.AllowReset = true
+		err = migrator.Reset(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Reset() err = %v; want nil", err)
+		}
+		var count int
+		err = db.QueryRow("SELECT COUNT(*) FROM courses").Scan(&count)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if count != 0 {
+			t.Errorf("count = %d; want 0", count)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+	})
+
+	t.Run("sqlx db", func(t *testing.T) {
+		db := sqlx.NewDb(sqliteInMem(t), "sqlite3")
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+		err := migrator.MigrateDB(db)
+		if err != nil {
+			t.Fatalf("MigrateDB() err = %v; want nil", err)
+		}
+		assertApplied(t, db.DB, "001_create_courses")
+		err = migrator.RollbackDB(db)
+		if err != nil {
+			t.Fatalf("RollbackDB() err = %v; want nil", err)
+		}
+		assertApplied(t, db.DB)
+	})
+
+	t.Run("require rollback", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, ""),
+			},
+			RequireRollback: true,
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrNoRollback) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrNoRollback)
+		}
+		if !strings.Contains(err.Error(), "002_create_users") || strings.Contains(err.Error(), "001_create_courses") {
+			t.Errorf("Migrate() err = %v; want it to list only 002_create_users", err)
+		}
+		_, err = db.Exec("INSERT INTO courses (name) VALUES ('Gophercises')")
+		if err == nil {
+			t.Fatalf("db.Exec() err = nil; want an error since no migrations should have run")
+		}
+
+		migrator.RequireRollback = false
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+	})
+
+	t.Run("on step", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var steps []string
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_broken", "NOT VALID SQL", ""),
+			},
+			OnStep: func(id string, d time.Duration, err error) {
+				if d <= 0 {
+					t.Errorf("OnStep(%q) d = %v; want > 0", id, d)
+				}
+				steps = append(steps, fmt.Sprintf("%s %t", id, err != nil))
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want an error")
+		}
+		want := []string{"001_create_courses false", "002_broken true"}
+		if fmt.Sprint(steps) != fmt.Sprint(want) {
+			t.Errorf("steps = %v; want %v", steps, want)
+		}
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_broken", "NOT VALID SQL", ""),
+				migrate.SqlxQueryMigration("002_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("003_also_broken", "ALSO NOT VALID SQL", ""),
+				migrate.SqlxQueryMigration("004_create_users", createUsersSql, dropUsersSql),
+			},
+			ContinueOnError: true,
+		}
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("MigrateWithResult() err = nil; want an error")
+		}
+		var failed []string
+		for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var merr *migrate.MigrationError
+			if !errors.As(e, &merr) {
+				t.Fatalf("err = %v; want a *MigrationError", e)
+			}
+			failed = append(failed, merr.ID)
+		}
+		if want := []string{"001_broken", "003_also_broken"}; fmt.Sprint(failed) != fmt.Sprint(want) {
+			t.Errorf("failed = %v; want %v", failed, want)
+		}
+		if want := []string{"002_create_courses", "004_create_users"}; fmt.Sprint(res.Applied) != fmt.Sprint(want) {
+			t.Errorf("Applied = %v; want %v", res.Applied, want)
+		}
+		assertApplied(t, db, "002_create_courses", "004_create_users")
+	})
+
+	t.Run("skip table creation", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+			SkipTableCreation: true,
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrMissingTable) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrMissingTable)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrMissingTable) {
+			t.Fatalf("Rollback() err = %v; want %v", err, migrate.ErrMissingTable)
+		}
+		_, err = db.Exec("CREATE TABLE migrations (id TEXT PRIMARY KEY, checksum TEXT, applied_at TIMESTAMP, dirty BOOLEAN, description TEXT)")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+	})
+
+	t.Run("raw sql", func(t *testing.T) {
+		readFile := func(filename string) string {
+			b, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatalf("ReadFile() err = %v; want nil", err)
+			}
+			return string(b)
+		}
+		combined, err := migrate.SqlxCombinedFileMigration("003_create_courses", "testdata/courses.combined.sql")
+		if err != nil {
+			t.Fatalf("SqlxCombinedFileMigration() err = %v; want nil", err)
+		}
+		tests := map[string]struct {
+			m        migrate.SqlxMigration
+			up, down string
+		}{
+			"query": {
+				m:    migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				up:   createCoursesSql,
+				down: dropCoursesSql,
+			},
+			"file": {
+				m:    migrate.SqlxFileMigration("002_create_widgets", "testdata/widgets.sql", "testdata/widgets.down.sql"),
+				up:   readFile("testdata/widgets.sql"),
+				down: readFile("testdata/widgets.down.sql"),
+			},
+			"combined": {
+				m:    combined,
+				up:   combined.UpQuery,
+				down: "DROP TABLE courses;",
+			},
+			"template": {
+				m:    migrate.SqlxTemplateMigration("004_create_users", "CREATE TABLE {{.}} (id int);", "DROP TABLE {{.}};", "users"),
+				up:   "CREATE TABLE users (id int);",
+				down: "DROP TABLE users;",
+			},
+		}
+		for name, tc := range tests {
+			if tc.m.UpQuery != tc.up || tc.up == "" {
+				t.Errorf("%s: UpQuery = %q; want %q", name, tc.m.UpQuery, tc.up)
+			}
+			if tc.m.DownQuery != tc.down {
+				t.Errorf("%s: DownQuery = %q; want %q", name, tc.m.DownQuery, tc.down)
+			}
+			if tc.m.Migrate == nil || tc.m.Rollback == nil {
+				t.Errorf("%s: Migrate and Rollback should still be set", name)
+			}
+		}
+	})
+
+	t.Run("func migration", func(t *testing.T) {
+		type ctxKey struct{}
+		var gotUp, gotDown interface{}
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxFuncMigration("002_seed_courses",
+					func(ctx context.Context, tx *sqlx.Tx) error {
+						gotUp = ctx.Value(ctxKey{})
+						_, err := tx.ExecContext(ctx, "INSERT INTO courses (name) VALUES ('seeded')")
+						return err
+					},
+					func(ctx context.Context, tx *sqlx.Tx) error {
+						gotDown = ctx.Value(ctxKey{})
+						_, err := tx.ExecContext(ctx, "DELETE FROM courses WHERE name = 'seeded'")
+						return err
+					}),
+				migrate.SqlxFuncMigration("003_no_rollback", func(ctx context.Context, tx *sqlx.Tx) error {
+					return nil
+				}, nil),
+			},
+		}
+		ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+		err := migrator.MigrateContext(ctx, db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateContext() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_seed_courses", "003_no_rollback")
+		if gotUp != "value" {
+			t.Errorf("up ctx.Value() = %v; want %q", gotUp, "value")
+		}
+
+		err = migrator.RollbackContext(ctx, db, "sqlite3")
+		if err != nil {
+			t.Fatalf("RollbackContext() err = %v; want nil", err)
+		}
+		if gotDown != "value" {
+			t.Errorf("down ctx.Value() = %v; want %q", gotDown, "value")
+		}
+	})
+
+	t.Run("dialects", func(t *testing.T) {
+		postgresOnly := migrate.SqlxQueryMigration("002_create_extension", "CREATE EXTENSION IF NOT EXISTS citext;", "DROP EXTENSION citext;")
+		postgresOnly.OnlyDialects = []string{"postgres", "pgx"}
+		notSqlite := migrate.SqlxQueryMigration("003_create_index", "CREATE INDEX CONCURRENTLY courses_name ON courses (name);", "DROP INDEX courses_name;")
+		notSqlite.SkipDialects = []string{"sqlite3"}
+		notSqlite.DisableTx = true
+		sqliteOnly := migrate.SqlxQueryMigration("004_create_users", createUsersSql, dropUsersSql)
+		sqliteOnly.OnlyDialects = []string{"sqlite3"}
+
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				postgresOnly,
+				notSqlite,
+				sqliteOnly,
+			},
+			SingleTransaction: true,
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_extension", "003_create_index", "004_create_users")
+		_, err = db.Exec("INSERT INTO users (email) VALUES ('jon@calhoun.io')")
+		if err != nil {
+			t.Fatalf("users insert err = %v; want nil", err)
+		}
+		status, err := migrator.Status(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Status() err = %v; want nil", err)
+		}
+		for _, st := range status {
+			if !st.Applied {
+				t.Errorf("Status(%q).Applied = false; want true", st.ID)
+			}
+		}
+
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db)
+	})
+
+	t.Run("rollback id", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_index", "CREATE INDEX courses_name ON courses (name);", "DROP INDEX courses_name;"),
+				migrate.SqlxQueryMigration("003_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxQueryMigration("004_seed_users", "INSERT INTO users (email) VALUES ('jon@calhoun.io');", ""),
+				migrate.SqlxQueryMigration("005_create_widgets", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"),
+			},
+		}
+		err := migrator.MigrateTo(db, "sqlite3", "004_seed_users")
+		if err != nil {
+			t.Fatalf("MigrateTo() err = %v; want nil", err)
+		}
+
+		tests := map[string]struct {
+			id   string
+			want error
+		}{
+			"unknown":       {id: "999_missing", want: migrate.ErrMigrationNotFound},
+			"not applied":   {id: "005_create_widgets", want: migrate.ErrNotApplied},
+			"no rollback":   {id: "004_seed_users", want: migrate.ErrNoRollback},
+			"later applied": {id: "002_create_index", want: migrate.ErrLaterMigrationsApplied},
+		}
+		for name, tc := range tests {
+			err = migrator.RollbackID(db, "sqlite3", tc.id)
+			if !errors.Is(err, tc.want) {
+				t.Errorf("%s: RollbackID() err = %v; want %v", name, err, tc.want)
+			}
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_index", "003_create_users", "004_seed_users")
+
+		migrator.Force = true
+		err = migrator.RollbackID(db, "sqlite3", "002_create_index")
+		if err != nil {
+			t.Fatalf("RollbackID() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "003_create_users", "004_seed_users")
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'courses_name'").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 0 {
+			t.Errorf("courses_name index still exists after RollbackID")
+		}
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		tagged := func(m migrate.SqlxMigration, tags ...string) migrate.SqlxMigration {
+			m.Tags = tags
+			return m
+		}
+		db := sqliteInMem(t)
+		all := []migrate.SqlxMigration{
+			tagged(migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql), "schema"),
+			tagged(migrate.SqlxQueryMigration("002_seed_courses", "INSERT INTO courses (name) VALUES ('seeded');", "DELETE FROM courses;"), "seed"),
+			tagged(migrate.SqlxQueryMigration("003_create_users", createUsersSql, dropUsersSql), "schema", "users"),
+			migrate.SqlxQueryMigration("004_untagged", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"),
+		}
+		migrator := migrate.NewSqlx(all, migrate.WithTags("schema"))
+		migrator.Printf = func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		}
+		migrator.Strict = true
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "003_create_users")
+
+		// Seeds applied by another profile aren't orphaned or reported.
+		seeder := migrate.Sqlx{Printf: migrator.Printf, Migrations: all, OnlyTags: []string{"seed"}}
+		err = seeder.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("seeder Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_seed_courses", "003_create_users")
+		statuses, err := migrator.Status(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Status() err = %v; want nil", err)
+		}
+		var ids []string
+		for _, st := range statuses {
+			ids = append(ids, st.ID)
+			if !st.Applied || st.Orphaned {
+				t.Errorf("Status(%q) = %+v; want applied and not orphaned", st.ID, st)
+			}
+		}
+		if want := []string{"001_create_courses", "003_create_users"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("Status() ids = %v; want %v", ids, want)
+		}
+		err = migrator.EnsureLatest(db, "sqlite3")
+		if err != nil {
+			t.Errorf("EnsureLatest() err = %v; want nil", err)
+		}
+
+		err = seeder.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("seeder Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "003_create_users")
+	})
+
+	t.Run("progress", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var lines []string
+		var progress [][2]int
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				lines = append(lines, fmt.Sprintf(format, args...))
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxQueryMigration("003_create_widgets", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"),
+				migrate.SqlxQueryMigration("004_create_gadgets", "CREATE TABLE gadgets (id int);", "DROP TABLE gadgets;"),
+			},
+			OnProgress: func(done, total int) {
+				progress = append(progress, [2]int{done, total})
+			},
+		}
+		err := migrator.MigrateTo(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("MigrateTo() err = %v; want nil", err)
+		}
+		progress, lines = nil, nil
+
+		// Only pending migrations count towards the total, and MigrateN caps
+		// it at n.
+		err = migrator.MigrateN(db, "sqlite3", 2)
+		if err != nil {
+			t.Fatalf("MigrateN() err = %v; want nil", err)
+		}
+		want := [][2]int{{1, 2}, {2, 2}}
+		if !reflect.DeepEqual(progress, want) {
+			t.Errorf("progress = %v; want %v", progress, want)
+		}
+		for _, line := range []string{
+			"Running migration (1/2): 002_create_users\n",
+			"Running migration (2/2): 003_create_widgets\n",
+		} {
+			found := false
+			for _, l := range lines {
+				found = found || l == line
+			}
+			if !found {
+				t.Errorf("lines = %q; want %q", lines, line)
+			}
+		}
+
+		progress = nil
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		if want := [][2]int{{1, 1}}; !reflect.DeepEqual(progress, want) {
+			t.Errorf("progress = %v; want %v", progress, want)
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		db := sqliteInMem(t)
+		events := make(chan migrate.MigrationEvent, 100)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+				migrate.SqlxQueryMigration("003_fail", "not valid sql", ""),
+			},
+			Events: events,
+		}
+		err := migrator.MigrateTo(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("MigrateTo() err = %v; want nil", err)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want an error from 003_fail")
+		}
+		err = migrator.RollbackN(db, "sqlite3", 1)
+		if err != nil {
+			t.Fatalf("RollbackN() err = %v; want nil", err)
+		}
+		close(events)
+
+		type phaseID struct {
+			phase migrate.Phase
+			id    string
+		}
+		var got []phaseID
+		for e := range events {
+			got = append(got, phaseID{e.Phase, e.ID})
+			if e.Phase == migrate.PhaseError && e.Err == nil {
+				t.Errorf("event %v has no Err; want the migration's error", e)
+			}
+			if (e.Phase == migrate.PhaseStart || e.Phase == migrate.PhaseSkip) && e.Duration != 0 {
+				t.Errorf("event %v has Duration %v; want 0", e, e.Duration)
+			}
+		}
+		want := []phaseID{
+			{migrate.PhaseStart, "001_create_courses"},
+			{migrate.PhaseDone, "001_create_courses"},
+			{migrate.PhaseSkip, "001_create_courses"},
+			{migrate.PhaseStart, "002_create_users"},
+			{migrate.PhaseDone, "002_create_users"},
+			{migrate.PhaseStart, "003_fail"},
+			{migrate.PhaseError, "003_fail"},
+			{migrate.PhaseSkip, "003_fail"},
+			{migrate.PhaseStart, "002_create_users"},
+			{migrate.PhaseDone, "002_create_users"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("events = %v; want %v", got, want)
+		}
+	})
+
+	t.Run("events without a receiver", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+			// Nothing ever reads from this channel, so every send would block.
+			Events: make(chan migrate.MigrationEvent),
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+	})
+
+	t.Run("require migrations", func(t *testing.T) {
+		db := sqliteInMem(t)
+		// A pattern that matches nothing, such as one pointed at the wrong
+		// directory, loads no migrations without an error.
+		migrations, err := migrate.GlobMigrations(fstest.MapFS{
+			"migrations/001_create_courses.sql": {Data: []byte(createCoursesSql)},
+		}, "migration/*.sql")
+		if err != nil {
+			t.Fatalf("GlobMigrations() err = %v; want nil", err)
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: migrations,
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil without RequireMigrations", err)
+		}
+		_, err = db.Exec("DROP TABLE migrations")
+		if err != nil {
+			t.Fatalf("Exec() err = %v; want nil", err)
+		}
+
+		migrator.RequireMigrations = true
+		err = migrator.Validate()
+		if !errors.Is(err, migrate.ErrNoMigrations) {
+			t.Errorf("Validate() err = %v; want %v", err, migrate.ErrNoMigrations)
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrNoMigrations) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrNoMigrations)
+		}
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'migrations'").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 0 {
+			t.Errorf("migrations table exists; want it not to be created")
+		}
+
+		migrator.Migrations = []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		}
+		migrator.OnlyTags = []string{"seed"}
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, migrate.ErrNoMigrations) {
+			t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrNoMigrations)
+		}
+		if !strings.Contains(err.Error(), "seed") {
+			t.Errorf("Migrate() err = %v; want it to mention the tags", err)
+		}
+
+		migrator.OnlyTags = nil
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+	})
+
+	t.Run("on complete", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var schema []string
+		errComplete := errors.New("refresh failed")
+		var completeErr error
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			},
+			OnComplete: func(ctx context.Context, db *sqlx.DB) error {
+				schema = nil
+				err := db.SelectContext(ctx, &schema, "SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'migrations' ORDER BY name")
+				if err != nil {
+					return err
+				}
+				return completeErr
+			},
+		}
+		err := migrator.MigrateTo(db, "sqlite3", "001_create_courses")
+		if err != nil {
+			t.Fatalf("MigrateTo() err = %v; want nil", err)
+		}
+		if want := []string{"courses"}; !reflect.DeepEqual(schema, want) {
+			t.Errorf("schema = %v; want %v", schema, want)
+		}
+
+		completeErr = errComplete
+		err = migrator.Migrate(db, "sqlite3")
+		if !errors.Is(err, errComplete) {
+			t.Fatalf("Migrate() err = %v; want %v", err, errComplete)
+		}
+		if want := []string{"courses", "users"}; !reflect.DeepEqual(schema, want) {
+			t.Errorf("schema = %v; want %v", schema, want)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+
+		// OnComplete isn't called when a migration fails.
+		schema = nil
+		migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("003_fail", "not valid sql", ""))
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil || errors.Is(err, errComplete) {
+			t.Fatalf("Migrate() err = %v; want the migration's error", err)
+		}
+		if schema != nil {
+			t.Errorf("OnComplete was called after a failed migration")
+		}
+	})
+
+	t.Run("after migrate", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var lines []string
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				lines = append(lines, fmt.Sprintf(format, args...))
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+			AfterMigrate: []string{"ANALYZE", "VACUUM"},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'sqlite_stat1'").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 1 {
+			t.Errorf("sqlite_stat1 missing; want ANALYZE to have been run")
+		}
+
+		// Nothing is run when no migrations were applied.
+		lines = nil
+		migrator.AfterMigrate = []string{"not valid sql"}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		for _, line := range lines {
+			if strings.Contains(line, "maintenance") {
+				t.Errorf("lines = %q; want no maintenance to be run", lines)
+			}
+		}
+
+		migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql))
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil || !strings.Contains(err.Error(), "not valid sql") {
+			t.Fatalf("Migrate() err = %v; want the maintenance error", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+
+		migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("003_create_widgets", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"))
+		migrator.IgnoreAfterMigrateErrors = true
+		lines = nil
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil with IgnoreAfterMigrateErrors", err)
+		}
+		found := false
+		for _, line := range lines {
+			found = found || strings.HasPrefix(line, "Maintenance failed: not valid sql")
+		}
+		if !found {
+			t.Errorf("lines = %q; want the maintenance failure to be logged", lines)
+		}
+	})
+
+	t.Run("rollback without migrations table", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+		err := migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		err = migrator.RollbackN(db, "sqlite3", 5)
+		if err != nil {
+			t.Fatalf("RollbackN() err = %v; want nil", err)
+		}
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'migrations'").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 0 {
+			t.Errorf("migrations table exists; want Rollback not to create it")
+		}
+	})
+
+	t.Run("savepoints", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			continueOnError bool
+			wantApplied     []string
+		}{
+			"stop":              {wantApplied: []string{"001_create_courses", "002_create_users"}},
+			"continue on error": {continueOnError: true, wantApplied: []string{"001_create_courses", "002_create_users", "004_create_gadgets"}},
+		} {
+			t.Run(name, func(t *testing.T) {
+				db := sqliteInMem(t)
+				migrator := migrate.Sqlx{
+					Printf: func(format string, args ...interface{}) (int, error) {
+						t.Logf(format, args...)
+						return 0, nil
+					},
+					Migrations: []migrate.SqlxMigration{
+						migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+						migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+						migrate.SqlxQueryMigration("003_create_widgets", "CREATE TABLE widgets (id int); not valid sql;", "DROP TABLE widgets;"),
+						migrate.SqlxQueryMigration("004_create_gadgets", "CREATE TABLE gadgets (id int);", "DROP TABLE gadgets;"),
+					},
+					SingleTransaction: true,
+					Savepoints:        true,
+					ContinueOnError:   tc.continueOnError,
+				}
+				res, err := migrator.MigrateWithResult(db, "sqlite3")
+				if err == nil || !strings.Contains(err.Error(), "003_create_widgets") {
+					t.Fatalf("MigrateWithResult() err = %v; want the error from 003_create_widgets", err)
+				}
+				if !reflect.DeepEqual(res.Applied, tc.wantApplied) {
+					t.Errorf("res.Applied = %v; want %v", res.Applied, tc.wantApplied)
+				}
+				assertApplied(t, db, tc.wantApplied...)
+				var n int
+				err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'widgets'").Scan(&n)
+				if err != nil {
+					t.Fatalf("QueryRow() err = %v; want nil", err)
+				}
+				if n != 0 {
+					t.Errorf("widgets table exists; want 003_create_widgets rolled back to its savepoint")
+				}
+			})
+		}
+	})
+
+	t.Run("reader migration", func(t *testing.T) {
+		db := sqliteInMem(t)
+		m, err := migrate.SqlxReaderMigration("001_create_courses", strings.NewReader(createCoursesSql), strings.NewReader(dropCoursesSql))
+		if err != nil {
+			t.Fatalf("SqlxReaderMigration() err = %v; want nil", err)
+		}
+		upOnly, err := migrate.SqlxReaderMigration("002_create_users", strings.NewReader(createUsersSql), nil)
+		if err != nil {
+			t.Fatalf("SqlxReaderMigration() err = %v; want nil", err)
+		}
+		if upOnly.Rollback != nil {
+			t.Errorf("Rollback = non-nil; want nil without a down reader")
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{m, upOnly},
+		}
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+
+		errRead := errors.New("connection reset")
+		_, err = migrate.SqlxReaderMigration("003_broken", iotest.ErrReader(errRead), nil)
+		if !errors.Is(err, errRead) {
+			t.Errorf("SqlxReaderMigration() err = %v; want %v", err, errRead)
+		}
+	})
+
+	t.Run("result single transaction", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+			SingleTransaction: true,
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		migrator.Migrations = append(migrator.Migrations,
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			migrate.SqlxQueryMigration("003_create_widgets", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"))
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if want := []string{"002_create_users", "003_create_widgets"}; !reflect.DeepEqual(res.Applied, want) {
+			t.Errorf("Applied = %v; want %v", res.Applied, want)
+		}
+		if want := []string{"001_create_courses"}; !reflect.DeepEqual(res.Skipped, want) {
+			t.Errorf("Skipped = %v; want %v", res.Skipped, want)
+		}
+		if res.WasApplied("001_create_courses") {
+			t.Errorf("WasApplied(001_create_courses) = true; want false")
+		}
+	})
+
+	t.Run("rollback applied order", func(t *testing.T) {
+		db := sqliteInMem(t)
+		var rolledBack []string
+		now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("003_create_widgets", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"),
+			},
+			OnEvent: func(e migrate.StepEvent) {
+				if e.Direction == migrate.DirectionDown && e.Outcome == migrate.OutcomeApplied {
+					rolledBack = append(rolledBack, e.ID)
+				}
+			},
+			Now: func() time.Time {
+				now = now.Add(time.Second)
+				return now
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		// 002 is merged in late, so it is applied after 003 even though it
+		// sorts before it.
+		migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql))
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+
+		err = migrator.RollbackN(db, "sqlite3", 1)
+		if err != nil {
+			t.Fatalf("RollbackN() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses", "003_create_widgets")
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		want := []string{"002_create_users", "003_create_widgets", "001_create_courses"}
+		if !reflect.DeepEqual(rolledBack, want) {
+			t.Errorf("rolled back %v; want %v", rolledBack, want)
+		}
+	})
+
+	t.Run("applied by", func(t *testing.T) {
+		db := sqliteInMem(t)
+		printf := func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		}
+		migrator := migrate.Sqlx{
+			Printf: printf,
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		_, err = db.Exec("SELECT applied_by FROM migrations")
 		if err == nil {
-			// Want an error here
-			t.Fatalf("db.QueryRow() err = nil; want table missing error")
+			t.Fatalf("applied_by column exists; want it only added when AppliedBy is set")
 		}
-		// Don't want to test inner workings of lib, so let's just migrate again and verify we have a table now
+
+		migrator.AppliedBy = "v1.4.2 (3f2a9c1)"
+		migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql))
 		err = migrator.Migrate(db, "sqlite3")
 		if err != nil {
 			t.Fatalf("Migrate() err = %v; want nil", err)
 		}
-		_, err = db.Exec("INSERT INTO courses (name) VALUES ($1) ", "cor_test")
+		statuses, err := migrator.Status(db, "sqlite3")
 		if err != nil {
-			t.Fatalf("db.Exec() err = %v; want nil", err)
+			t.Fatalf("Status() err = %v; want nil", err)
 		}
-		err = db.QueryRow("SELECT COUNT(*) FROM courses;").Scan(&count)
+		got := map[string]string{}
+		for _, st := range statuses {
+			got[st.ID] = st.AppliedBy
+		}
+		want := map[string]string{"001_create_courses": "", "002_create_users": "v1.4.2 (3f2a9c1)"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Status() AppliedBy = %v; want %v", got, want)
+		}
+	})
+
+	t.Run("drop table on empty", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			},
+			HistoryTable:     "migration_history",
+			DropTableOnEmpty: true,
+		}
+		tables := func() []string {
+			var names []string
+			rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name")
+			if err != nil {
+				t.Fatalf("Query() err = %v; want nil", err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var name string
+				err = rows.Scan(&name)
+				if err != nil {
+					t.Fatalf("Scan() err = %v; want nil", err)
+				}
+				names = append(names, name)
+			}
+			return names
+		}
+
+		err := migrator.Migrate(db, "sqlite3")
 		if err != nil {
-			// Want an error here
-			t.Fatalf("db.QueryRow() err = %v; want nil", err)
+			t.Fatalf("Migrate() err = %v; want nil", err)
 		}
-		if count != 1 {
-			t.Fatalf("count = %d; want %d", count, 1)
+		err = migrator.RollbackN(db, "sqlite3", 1)
+		if err != nil {
+			t.Fatalf("RollbackN() err = %v; want nil", err)
+		}
+		want := []string{"courses", "migration_history", "migrations"}
+		if got := tables(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("tables = %v; want %v while a migration is still applied", got, want)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		want = []string{"migration_history"}
+		if got := tables(); !reflect.DeepEqual(got, want) {
+			t.Errorf("tables = %v; want %v after rolling back everything", got, want)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil with the table already dropped", err)
+		}
+	})
+
+	t.Run("teardown", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		err = migrator.Teardown(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Teardown() err = %v; want nil", err)
+		}
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 0 {
+			t.Errorf("tables = %d; want none after Teardown", n)
+		}
+		if migrator.DropTableOnEmpty {
+			t.Errorf("DropTableOnEmpty = true; want Teardown to leave the migrator unchanged")
+		}
+	})
+
+	t.Run("custom bookkeeping", func(t *testing.T) {
+		db := sqliteInMem(t)
+		_, err := db.Exec("CREATE TABLE schema_versions (version TEXT PRIMARY KEY); INSERT INTO schema_versions VALUES ('001_create_courses')")
+		if err != nil {
+			t.Fatalf("Exec() err = %v; want nil", err)
+		}
+		_, err = db.Exec(createCoursesSql)
+		if err != nil {
+			t.Fatalf("Exec() err = %v; want nil", err)
+		}
+		versions := func() []string {
+			var got []string
+			rows, err := db.Query("SELECT version FROM schema_versions ORDER BY version")
+			if err != nil {
+				t.Fatalf("Query() err = %v; want nil", err)
+			}
+			defer rows.Close()
+			for rows.Next() {
+				var v string
+				err = rows.Scan(&v)
+				if err != nil {
+					t.Fatalf("Scan() err = %v; want nil", err)
+				}
+				got = append(got, v)
+			}
+			return got
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			},
+			IsApplied: func(db *sqlx.DB, id string) (bool, error) {
+				var n int
+				err := db.Get(&n, "SELECT COUNT(*) FROM schema_versions WHERE version = ?", id)
+				return n > 0, err
+			},
+			RecordApplied: func(ex sqlx.ExtContext, id string) error {
+				_, err := ex.ExecContext(context.Background(), "INSERT INTO schema_versions (version) VALUES (?)", id)
+				return err
+			},
+		}
+
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		if got, want := versions(), []string{"001_create_courses", "002_create_users"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("schema_versions = %v; want %v", got, want)
+		}
+		var n int
+		err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'migrations'").Scan(&n)
+		if err != nil {
+			t.Fatalf("QueryRow() err = %v; want nil", err)
+		}
+		if n != 0 {
+			t.Errorf("migrations table was created; want it skipped when IsApplied is set")
+		}
+
+		err = migrator.RollbackN(db, "sqlite3", 1)
+		if err == nil {
+			t.Fatalf("RollbackN() err = nil; want an error without RecordRolledBack")
+		}
+		migrator.RecordRolledBack = func(ex sqlx.ExtContext, id string) error {
+			_, err := ex.ExecContext(context.Background(), "DELETE FROM schema_versions WHERE version = ?", id)
+			return err
+		}
+		err = migrator.RollbackN(db, "sqlite3", 1)
+		if err != nil {
+			t.Fatalf("RollbackN() err = %v; want nil", err)
+		}
+		if got, want := versions(), []string{"001_create_courses"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("schema_versions = %v; want %v", got, want)
+		}
+
+		migrator.RecordApplied = nil
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Errorf("Migrate() err = nil; want an error without RecordApplied")
 		}
 	})
 }
 
+// assertApplied verifies that exactly the provided migration IDs are recorded
+// in the default migrations table.
+func assertApplied(t *testing.T, db *sql.DB, want ...string) {
+	t.Helper()
+	rows, err := db.Query("SELECT id FROM migrations ORDER BY id")
+	if err != nil {
+		t.Fatalf("db.Query() err = %v; want nil", err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			t.Fatalf("rows.Scan() err = %v; want nil", err)
+		}
+		got = append(got, id)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("applied = %v; want %v", got, want)
+	}
+}
+
 var (
 	createCoursesSql = `
 CREATE TABLE courses (
@@ -172,3 +2377,233 @@ CREATE TABLE users (
 );`
 	dropUsersSql = `DROP TABLE users;`
 )
+
+func TestSqlx_TxOptions(t *testing.T) {
+	db, fdb := openFake(t)
+	serializable := &sql.TxOptions{Isolation: sql.LevelSerializable}
+	readCommitted := &sql.TxOptions{Isolation: sql.LevelReadCommitted}
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			func() migrate.SqlxMigration {
+				m := migrate.SqlxQueryMigration("002_backfill_courses", "UPDATE courses SET name = 'x';", "")
+				m.TxOptions = readCommitted
+				return m
+			}(),
+		},
+		TxOptions: serializable,
+	}
+	err := migrator.Migrate(db, "postgres")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	// 002_backfill_courses has no rollback, so only 001_create_courses is
+	// rolled back.
+	err = migrator.RollbackN(db, "postgres", 1)
+	if err != nil {
+		t.Fatalf("RollbackN() err = %v; want nil", err)
+	}
+	got := fdb.TxOptions()
+	want := []driver.TxOptions{
+		{Isolation: driver.IsolationLevel(sql.LevelSerializable)},
+		{Isolation: driver.IsolationLevel(sql.LevelReadCommitted)},
+		{Isolation: driver.IsolationLevel(sql.LevelSerializable)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TxOptions() = %v; want %v", got, want)
+	}
+}
+
+func TestSqlx_PreparedStatements(t *testing.T) {
+	migrations := []migrate.SqlxMigration{
+		migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		migrate.SqlxQueryMigration("003_create_widgets", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"),
+	}
+	count := func(stmts []string, prefix string) int {
+		n := 0
+		for _, stmt := range stmts {
+			if strings.HasPrefix(stmt, prefix) {
+				n++
+			}
+		}
+		return n
+	}
+
+	for name, noPrepare := range map[string]bool{
+		"prepared":     false,
+		"not prepared": true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			db, fdb := openFake(t)
+			fdb.noPrepare = noPrepare
+			migrator := migrate.Sqlx{
+				Printf: func(format string, args ...interface{}) (int, error) {
+					t.Logf(format, args...)
+					return 0, nil
+				},
+				Migrations: migrations,
+			}
+			err := migrator.Migrate(db, "postgres")
+			if err != nil {
+				t.Fatalf("Migrate() err = %v; want nil", err)
+			}
+			err = migrator.Rollback(db, "postgres")
+			if err != nil {
+				t.Fatalf("Rollback() err = %v; want nil", err)
+			}
+			if got := count(fdb.Statements(), "INSERT INTO migrations "); got != 3 {
+				t.Errorf("ran %d inserts into migrations; want 3", got)
+			}
+			if got := count(fdb.Statements(), "DELETE FROM migrations "); got != 3 {
+				t.Errorf("ran %d deletes from migrations; want 3", got)
+			}
+			// Migrate and Rollback each prepare the statements once.
+			want := 2
+			if noPrepare {
+				want = 0
+			}
+			if got := count(fdb.Prepared(), "INSERT INTO migrations "); got != want {
+				t.Errorf("prepared the insert %d times; want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestSqlx_RowsAffected(t *testing.T) {
+	t.Run("sqlite3", func(t *testing.T) {
+		db := sqliteInMem(t)
+		file := filepath.Join(t.TempDir(), "003_prune_courses.sql")
+		err := os.WriteFile(file, []byte("UPDATE courses SET name = 'kept' WHERE id <= 2;\nDELETE FROM courses WHERE id = 3;"), 0644)
+		if err != nil {
+			t.Fatalf("WriteFile() err = %v; want nil", err)
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxFuncMigration("002_seed_courses", func(ctx context.Context, tx *sqlx.Tx) error {
+					_, err := tx.ExecContext(ctx, "INSERT INTO courses (id, name) VALUES (1, 'a'), (2, 'b'), (3, 'c')")
+					return err
+				}, nil),
+				migrate.SqlxFileMigration("003_prune_courses", file, "", migrate.WithStatementSplitting(true)),
+				migrate.SqlxQueryMigration("004_rename_courses", "UPDATE courses SET name = 'renamed';", ""),
+				migrate.SqlxTemplateMigration("005_retitle_courses", "UPDATE courses SET name = '{{.}}';", "", "retitled"),
+			},
+		}
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if _, ok := res.RowsAffected["002_seed_courses"]; ok {
+			t.Errorf("RowsAffected[002_seed_courses] is set; want func migrations left out")
+		}
+		for id, want := range map[string]int64{"003_prune_courses": 3, "004_rename_courses": 2, "005_retitle_courses": 2} {
+			if got, ok := res.RowsAffected[id]; !ok || got != want {
+				t.Errorf("RowsAffected[%s] = %d, %t; want %d, true", id, got, ok, want)
+			}
+		}
+	})
+
+	t.Run("overridden funcs", func(t *testing.T) {
+		db := sqliteInMem(t)
+		m := migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql)
+		m.Rollback = nil
+		wrapped := m.Migrate
+		var called bool
+		m.Migrate = func(tx *sqlx.Tx) error {
+			called = true
+			return wrapped(tx)
+		}
+		override := migrate.SqlxQueryMigration("002_rename_courses", "UPDATE courses SET name = 'renamed';", "DROP TABLE courses;")
+		override.Migrate = func(tx *sqlx.Tx) error {
+			_, err := tx.Exec("CREATE TABLE widgets (id int);")
+			return err
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{m, override},
+		}
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if !called {
+			t.Errorf("Migrate wrapper not called; want replaced Migrate funcs to be used")
+		}
+		if _, err := db.Exec("INSERT INTO widgets (id) VALUES (1)"); err != nil {
+			t.Errorf("db.Exec() err = %v; want the overriding Migrate to have created widgets", err)
+		}
+		if _, ok := res.RowsAffected["002_rename_courses"]; ok {
+			t.Errorf("RowsAffected[002_rename_courses] is set; want replaced Migrate funcs left out")
+		}
+
+		err = migrator.RollbackN(db, "sqlite3", 2)
+		if err != nil {
+			t.Fatalf("RollbackN() err = %v; want nil", err)
+		}
+		assertApplied(t, db, "001_create_courses")
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		db, _ := openFake(t)
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+				migrate.SqlxQueryMigration("002_rename_courses", "UPDATE courses SET name = 'renamed';", ""),
+			},
+		}
+		res, err := migrator.MigrateWithResult(db, "postgres")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		want := map[string]int64{"001_create_courses": -1, "002_rename_courses": 1}
+		if !reflect.DeepEqual(res.RowsAffected, want) {
+			t.Errorf("RowsAffected = %v; want %v", res.RowsAffected, want)
+		}
+	})
+}
+
+func BenchmarkSqlx_Migrate(b *testing.B) {
+	migrations := make([]migrate.SqlxMigration, 100)
+	for i := range migrations {
+		id := fmt.Sprintf("%03d_create_table", i)
+		migrations[i] = migrate.SqlxQueryMigration(id, fmt.Sprintf("CREATE TABLE t%d (id int);", i), "")
+	}
+	// A Store other than *SQLStore isn't prepared, so wrapping the default
+	// one gives a baseline to compare against.
+	for name, store := range map[string]migrate.Store{
+		"prepared":     nil,
+		"not prepared": struct{ *migrate.SQLStore }{&migrate.SQLStore{}},
+	} {
+		b.Run(name, func(b *testing.B) {
+			migrator := migrate.NewSqlx(migrations, migrate.WithSilent())
+			migrator.Store = store
+			for i := 0; i < b.N; i++ {
+				db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s_%d?mode=memory&cache=shared", b.Name(), i))
+				if err != nil {
+					b.Fatalf("Open() err = %v; want nil", err)
+				}
+				err = migrator.Migrate(db, "sqlite3")
+				if err != nil {
+					b.Fatalf("Migrate() err = %v; want nil", err)
+				}
+				db.Close()
+			}
+		})
+	}
+}
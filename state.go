@@ -0,0 +1,135 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// exportedState is the JSON document written by ExportState and read by
+// ImportState.
+type exportedState struct {
+	Migrations []exportedMigration `json:"migrations"`
+}
+
+type exportedMigration struct {
+	ID          string    `json:"id"`
+	Checksum    string    `json:"checksum,omitempty"`
+	AppliedAt   time.Time `json:"applied_at"`
+	Dirty       bool      `json:"dirty,omitempty"`
+	Description string    `json:"description,omitempty"`
+	AppliedBy   string    `json:"applied_by,omitempty"`
+}
+
+// ExportState returns every migration recorded as applied, including
+// orphaned migrations, as JSON sorted by ID. Like Status it only reads from
+// the database, and a missing migrations table is exported as no migrations.
+// The output can be passed to ImportState to record the same migrations in
+// another database, such as when cloning production's state into staging.
+func (s *Sqlx) ExportState(sqlDB *sql.DB, dialect string) ([]byte, error) {
+	_, applied, err := s.loadStatus(sqlDB, dialect)
+	if err != nil {
+		return nil, err
+	}
+	state := exportedState{Migrations: make([]exportedMigration, 0, len(applied))}
+	for _, a := range applied {
+		state.Migrations = append(state.Migrations, exportedMigration{
+			ID:          a.ID,
+			Checksum:    a.Checksum,
+			AppliedAt:   a.AppliedAt,
+			Dirty:       a.Dirty,
+			Description: a.Description,
+			AppliedBy:   a.AppliedBy,
+		})
+	}
+	sort.Slice(state.Migrations, func(i, j int) bool {
+		return CompareIDs(state.Migrations[i].ID, state.Migrations[j].ID) < 0
+	})
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("exporting state: %w", err)
+	}
+	return b, nil
+}
+
+// ImportState records the migrations in data, as written by ExportState, as
+// applied without running any of them. Their checksums, applied times, and
+// descriptions are kept as they were exported. Migrations that are already
+// recorded are left as they are, and nothing is removed, so importing into a
+// database with an empty migrations table gives an exact copy of the
+// exported state. The records are inserted in a single transaction, which
+// is rolled back rather than committed when DryRun is set.
+func (s *Sqlx) ImportState(sqlDB *sql.DB, dialect string, data []byte) (err error) {
+	var state exportedState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return fmt.Errorf("importing state: %w", err)
+	}
+	for i, m := range state.Migrations {
+		if m.ID == "" {
+			return fmt.Errorf("importing state: %w: migration at position %d", ErrEmptyID, i)
+		}
+	}
+
+	ctx := context.Background()
+	db, err := newDB(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	unlock, err := s.lock(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		uerr := unlock()
+		if err == nil {
+			err = uerr
+		}
+	}()
+
+	store, err := s.prepare(ctx, db)
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedMigrations(ctx, db, store)
+	if err != nil {
+		return err
+	}
+	errorf := func(err error) error { return fmt.Errorf("importing state: %w", err) }
+	tx, err := s.beginTx(ctx, db, nil)
+	if err != nil {
+		return errorf(err)
+	}
+	for _, m := range state.Migrations {
+		if _, ok := applied[m.ID]; ok {
+			s.log(LevelInfo, "Skipping already recorded migration: "+m.ID, Field{"id", m.ID}, Field{"outcome", "skipped"})
+			continue
+		}
+		s.log(LevelInfo, "Marking migration as applied: "+m.ID, Field{"id", m.ID}, Field{"outcome", "marked applied"})
+		err = store.Insert(ctx, tx, AppliedMigration{
+			ID:          m.ID,
+			Checksum:    m.Checksum,
+			AppliedAt:   m.AppliedAt.UTC(),
+			Dirty:       m.Dirty,
+			Description: m.Description,
+			AppliedBy:   m.AppliedBy,
+		})
+		if err != nil {
+			tx.Rollback()
+			return errorf(err)
+		}
+		applied[m.ID] = AppliedMigration{ID: m.ID}
+	}
+	if s.DryRun {
+		s.log(LevelInfo, "Dry run, undoing import", Field{"dry_run", true})
+		return tx.Rollback()
+	}
+	err = tx.Commit()
+	if err != nil {
+		return errorf(err)
+	}
+	return nil
+}
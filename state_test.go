@@ -0,0 +1,141 @@
+package migrate_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestExportImportState(t *testing.T) {
+	appliedAt := time.Date(2024, 3, 14, 15, 9, 26, 0, time.UTC)
+	newMigrator := func(t *testing.T) migrate.Sqlx {
+		courses := migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql)
+		courses.Description = "Create courses"
+		return migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{
+				courses,
+				migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			},
+			Now: func() time.Time { return appliedAt },
+		}
+	}
+
+	var exported []byte
+	t.Run("export", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := newMigrator(t)
+		var err error
+		exported, err = migrator.ExportState(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("ExportState() err = %v; want nil", err)
+		}
+		if string(exported) != "{\n  \"migrations\": []\n}" {
+			t.Errorf("ExportState() = %s; want no migrations", exported)
+		}
+
+		err = migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		exported, err = migrator.ExportState(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("ExportState() err = %v; want nil", err)
+		}
+		t.Logf("%s", exported)
+		var state struct {
+			Migrations []struct {
+				ID          string    `json:"id"`
+				Checksum    string    `json:"checksum"`
+				AppliedAt   time.Time `json:"applied_at"`
+				Description string    `json:"description"`
+			} `json:"migrations"`
+		}
+		err = json.Unmarshal(exported, &state)
+		if err != nil {
+			t.Fatalf("Unmarshal() err = %v; want nil", err)
+		}
+		if len(state.Migrations) != 2 {
+			t.Fatalf("len(migrations) = %d; want 2", len(state.Migrations))
+		}
+		got := state.Migrations[0]
+		if got.ID != "001_create_courses" || got.Checksum == "" || !got.AppliedAt.Equal(appliedAt) || got.Description != "Create courses" {
+			t.Errorf("migrations[0] = %+v; want 001_create_courses with its checksum, applied time, and description", got)
+		}
+	})
+
+	t.Run("import", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := newMigrator(t)
+		migrator.Now = func() time.Time { return appliedAt.Add(time.Hour) }
+		for i := 0; i < 2; i++ {
+			err := migrator.ImportState(db, "sqlite3", exported)
+			if err != nil {
+				t.Fatalf("ImportState() err = %v; want nil", err)
+			}
+		}
+		assertApplied(t, db, "001_create_courses", "002_create_users")
+		statuses, err := migrator.Status(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Status() err = %v; want nil", err)
+		}
+		for _, st := range statuses {
+			if !st.AppliedAt.Equal(appliedAt) {
+				t.Errorf("Status(%q).AppliedAt = %v; want %v", st.ID, st.AppliedAt, appliedAt)
+			}
+		}
+		if statuses[0].Description != "Create courses" {
+			t.Errorf("Status().Description = %q; want %q", statuses[0].Description, "Create courses")
+		}
+
+		// Nothing was run, so the tables don't exist, and Migrate considers
+		// every migration applied with matching checksums.
+		_, err = db.Exec("SELECT * FROM courses")
+		if err == nil {
+			t.Errorf("courses table exists; want ImportState not to run migrations")
+		}
+		res, err := migrator.MigrateWithResult(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+		}
+		if len(res.Applied) != 0 {
+			t.Errorf("Applied = %v; want none", res.Applied)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := newMigrator(t)
+		// Create the migrations table so that there is something that could
+		// be written to.
+		err := (&migrate.Sqlx{Printf: migrator.Printf}).Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		migrator.DryRun = true
+		err = migrator.ImportState(db, "sqlite3", exported)
+		if err != nil {
+			t.Fatalf("ImportState() err = %v; want nil", err)
+		}
+		assertApplied(t, db)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		db := sqliteInMem(t)
+		migrator := newMigrator(t)
+		for name, data := range map[string]string{
+			"malformed": "{",
+			"empty id":  `{"migrations": [{"id": ""}]}`,
+		} {
+			err := migrator.ImportState(db, "sqlite3", []byte(data))
+			if err == nil {
+				t.Errorf("%s: ImportState() err = nil; want error", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,239 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MigrationStatus describes whether a single migration has been run.
+type MigrationStatus struct {
+	ID      string
+	Applied bool
+	// Description is the configured migration's Description, or for orphaned
+	// migrations the description recorded when it was run.
+	Description string
+	// AppliedAt is when the migration was run, if that information is
+	// available. It is the zero time otherwise.
+	AppliedAt time.Time
+	// Dirty is true when the migration was run outside of a transaction and
+	// failed partway through. See ErrDirtyState.
+	Dirty bool
+	// AppliedBy is the AppliedBy recorded when the migration was run. It is
+	// only read from the default Store when AppliedBy is set on the migrator
+	// reporting the status.
+	AppliedBy string
+	// Orphaned is true when the migration is recorded in the migrations table
+	// but isn't one of the configured Migrations.
+	Orphaned bool
+}
+
+// ErrPendingMigrations is returned by EnsureLatest when some of the configured
+// migrations haven't been run.
+var ErrPendingMigrations = errors.New("pending migrations")
+
+// ErrOrphanedMigration is returned when Strict is set and a migration that
+// has been applied isn't one of the configured Migrations.
+var ErrOrphanedMigration = errors.New("orphaned migration")
+
+// Status reports whether each of the configured migrations has been run
+// without running anything. Migrations are reported in the order they would
+// be run, followed by any orphaned migrations sorted by ID. If the migrations
+// table doesn't exist it isn't created; every migration is reported as not
+// applied instead. The same is true of EnsureLatest, Version, Pending, and
+// Applied.
+func (s *Sqlx) Status(sqlDB *sql.DB, dialect string) ([]MigrationStatus, error) {
+	migrations, applied, err := s.loadStatus(sqlDB, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	// Migrations excluded by OnlyTags are known but not reported.
+	known := make(map[string]struct{}, len(s.Migrations))
+	for _, m := range s.Migrations {
+		known[m.ID] = struct{}{}
+	}
+	for _, m := range migrations {
+		a, ok := applied[m.ID]
+		statuses = append(statuses, MigrationStatus{
+			ID:          m.ID,
+			Applied:     ok,
+			Description: m.Description,
+			AppliedAt:   a.AppliedAt,
+			Dirty:       a.Dirty,
+			AppliedBy:   a.AppliedBy,
+		})
+	}
+	var orphaned []string
+	for id := range applied {
+		if _, ok := known[id]; !ok {
+			orphaned = append(orphaned, id)
+		}
+	}
+	sort.Slice(orphaned, func(i, j int) bool {
+		return CompareIDs(orphaned[i], orphaned[j]) < 0
+	})
+	for _, id := range orphaned {
+		statuses = append(statuses, MigrationStatus{
+			ID:          id,
+			Applied:     true,
+			Description: applied[id].Description,
+			AppliedAt:   applied[id].AppliedAt,
+			Dirty:       applied[id].Dirty,
+			AppliedBy:   applied[id].AppliedBy,
+			Orphaned:    true,
+		})
+	}
+	return statuses, nil
+}
+
+// EnsureLatest returns ErrPendingMigrations, listing the IDs of the pending
+// migrations, if any of the configured migrations haven't been run. Nothing
+// is run either way. It is intended for applications whose migrations are run
+// by a separate job to check the database is up to date at startup.
+func (s *Sqlx) EnsureLatest(sqlDB *sql.DB, dialect string) error {
+	statuses, err := s.Status(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	var pending []string
+	for _, st := range statuses {
+		if !st.Applied {
+			pending = append(pending, st.ID)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %q", ErrPendingMigrations, pending)
+	}
+	return nil
+}
+
+// Version returns the ID of the most recently applied migration, or an empty
+// string if none have been run. Only configured migrations are considered.
+// They are compared by when they were applied, falling back to the order they
+// would be run in for migrations applied at the same time or recorded before
+// applied_at was tracked.
+func (s *Sqlx) Version(sqlDB *sql.DB, dialect string) (string, error) {
+	statuses, err := s.Status(sqlDB, dialect)
+	if err != nil {
+		return "", err
+	}
+	var latest *MigrationStatus
+	for i, st := range statuses {
+		if !st.Applied || st.Orphaned {
+			continue
+		}
+		if latest == nil || !st.AppliedAt.Before(latest.AppliedAt) {
+			latest = &statuses[i]
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+	return latest.ID, nil
+}
+
+// checkOrphaned returns ErrOrphanedMigration listing any applied migrations
+// that aren't configured.
+func (s *Sqlx) checkOrphaned(applied map[string]AppliedMigration) error {
+	known := make(map[string]struct{}, len(s.Migrations))
+	for _, m := range s.Migrations {
+		known[m.ID] = struct{}{}
+	}
+	var orphaned []string
+	for id := range applied {
+		if _, ok := known[id]; !ok {
+			orphaned = append(orphaned, id)
+		}
+	}
+	if len(orphaned) > 0 {
+		sort.Slice(orphaned, func(i, j int) bool {
+			return CompareIDs(orphaned[i], orphaned[j]) < 0
+		})
+		return fmt.Errorf("%w: %q", ErrOrphanedMigration, orphaned)
+	}
+	return nil
+}
+
+// Pending returns the configured migrations that haven't been run yet, in the
+// order they would be run.
+func (s *Sqlx) Pending(sqlDB *sql.DB, dialect string) ([]SqlxMigration, error) {
+	return s.filterApplied(sqlDB, dialect, false)
+}
+
+// NextPending returns the migration the next call to Migrate would run first,
+// or nil if every migration has been run. Nothing is run. For migrations
+// created from SQL, such as with SqlxQueryMigration or FSMigrations, the SQL
+// it would run is available in its UpQuery field.
+func (s *Sqlx) NextPending(sqlDB *sql.DB, dialect string) (*SqlxMigration, error) {
+	pending, err := s.Pending(sqlDB, dialect)
+	if err != nil {
+		return nil, err
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	return &pending[0], nil
+}
+
+// Applied returns the configured migrations that have been run, in the order
+// they would be run. Orphaned migrations aren't included since there is no
+// SqlxMigration for them; use Status to find those.
+func (s *Sqlx) Applied(sqlDB *sql.DB, dialect string) ([]SqlxMigration, error) {
+	return s.filterApplied(sqlDB, dialect, true)
+}
+
+// filterApplied returns the configured migrations whose applied state
+// matches wantApplied.
+func (s *Sqlx) filterApplied(sqlDB *sql.DB, dialect string, wantApplied bool) ([]SqlxMigration, error) {
+	migrations, applied, err := s.loadStatus(sqlDB, dialect)
+	if err != nil {
+		return nil, err
+	}
+	var ret []SqlxMigration
+	for _, m := range migrations {
+		if _, ok := applied[m.ID]; ok == wantApplied {
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+// loadStatus returns the configured migrations in order along with every
+// applied migration, loaded with a single query. It doesn't create the
+// migrations table if the Store can report that it is missing, so that it
+// only needs read access to the database.
+func (s *Sqlx) loadStatus(sqlDB *sql.DB, dialect string) ([]SqlxMigration, map[string]AppliedMigration, error) {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return nil, nil, err
+	}
+	ctx := context.Background()
+	db, err := newDB(sqlDB, dialect)
+	if err != nil {
+		return nil, nil, err
+	}
+	missing, err := s.missingTable(ctx, db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if missing {
+		return migrations, map[string]AppliedMigration{}, nil
+	}
+	store := s.store()
+	if _, ok := store.(TableChecker); !ok {
+		store, err = s.prepare(ctx, db)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	applied, err := s.appliedMigrations(ctx, db, store)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrations, applied, nil
+}
@@ -0,0 +1,430 @@
+package migrate_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSqlx_Status(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		},
+	}
+	before := time.Now()
+	err := migrator.MigrateN(db, "sqlite3", 1)
+	if err != nil {
+		t.Fatalf("MigrateN() err = %v; want nil", err)
+	}
+	_, err = db.Exec("INSERT INTO migrations (id) VALUES ('000_deleted')")
+	if err != nil {
+		t.Fatalf("db.Exec() err = %v; want nil", err)
+	}
+
+	got, err := migrator.Status(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	want := []migrate.MigrationStatus{
+		{ID: "001_create_courses", Applied: true},
+		{ID: "002_create_users", Applied: false},
+		{ID: "000_deleted", Applied: true, Orphaned: true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("len(Status()) = %d; want %d", len(got), len(want))
+	}
+	for i := range want {
+		appliedAt := got[i].AppliedAt
+		got[i].AppliedAt = time.Time{}
+		if got[i] != want[i] {
+			t.Errorf("Status()[%d] = %+v; want %+v", i, got[i], want[i])
+		}
+		if want[i].ID == "001_create_courses" && (appliedAt.Before(before) || appliedAt.After(time.Now())) {
+			t.Errorf("Status()[%d].AppliedAt = %v; want a time after %v", i, appliedAt, before)
+		}
+	}
+}
+
+func TestSqlx_EnsureLatest(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		},
+	}
+	err := migrator.MigrateN(db, "sqlite3", 1)
+	if err != nil {
+		t.Fatalf("MigrateN() err = %v; want nil", err)
+	}
+	err = migrator.EnsureLatest(db, "sqlite3")
+	if !errors.Is(err, migrate.ErrPendingMigrations) {
+		t.Fatalf("EnsureLatest() err = %v; want %v", err, migrate.ErrPendingMigrations)
+	}
+	if !strings.Contains(err.Error(), "002_create_users") || strings.Contains(err.Error(), "001_create_courses") {
+		t.Errorf("EnsureLatest() err = %v; want it to list only 002_create_users", err)
+	}
+
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	err = migrator.EnsureLatest(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("EnsureLatest() err = %v; want nil", err)
+	}
+}
+
+func TestSqlx_Version(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		},
+	}
+	version, err := migrator.Version(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Version() err = %v; want nil", err)
+	}
+	if version != "" {
+		t.Errorf("Version() = %q; want %q", version, "")
+	}
+
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	version, err = migrator.Version(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Version() err = %v; want nil", err)
+	}
+	if version != "002_create_users" {
+		t.Errorf("Version() = %q; want %q", version, "002_create_users")
+	}
+
+	// Migrations recorded without applied_at fall back to the configured
+	// order.
+	_, err = db.Exec("UPDATE migrations SET applied_at = NULL")
+	if err != nil {
+		t.Fatalf("db.Exec() err = %v; want nil", err)
+	}
+	version, err = migrator.Version(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Version() err = %v; want nil", err)
+	}
+	if version != "002_create_users" {
+		t.Errorf("Version() = %q; want %q", version, "002_create_users")
+	}
+
+	// Migrations that are no longer configured are ignored, even when they
+	// were applied at the same time as the configured ones.
+	_, err = db.Exec("INSERT INTO migrations (id) VALUES ('003_removed')")
+	if err != nil {
+		t.Fatalf("db.Exec() err = %v; want nil", err)
+	}
+	version, err = migrator.Version(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Version() err = %v; want nil", err)
+	}
+	if version != "002_create_users" {
+		t.Errorf("Version() = %q; want %q", version, "002_create_users")
+	}
+}
+
+func TestSqlx_Strict(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		},
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	// Deleting a migration from the list without rolling it back leaves it
+	// orphaned.
+	migrator.Migrations = migrator.Migrations[:1]
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+
+	migrator.Strict = true
+	err = migrator.Migrate(db, "sqlite3")
+	if !errors.Is(err, migrate.ErrOrphanedMigration) {
+		t.Fatalf("Migrate() err = %v; want %v", err, migrate.ErrOrphanedMigration)
+	}
+	if !strings.Contains(err.Error(), "002_create_users") {
+		t.Errorf("Migrate() err = %v; want it to list 002_create_users", err)
+	}
+	err = migrator.Rollback(db, "sqlite3")
+	if !errors.Is(err, migrate.ErrOrphanedMigration) {
+		t.Fatalf("Rollback() err = %v; want %v", err, migrate.ErrOrphanedMigration)
+	}
+}
+
+func TestSqlx_Now(t *testing.T) {
+	db := sqliteInMem(t)
+	frozen := time.Date(2024, 3, 9, 14, 5, 7, 0, time.UTC)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		},
+		Now: func() time.Time { return frozen },
+	}
+	res, err := migrator.MigrateWithResult(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("MigrateWithResult() err = %v; want nil", err)
+	}
+	if res.Duration != 0 || res.Durations["001_create_courses"] != 0 {
+		t.Errorf("durations = %v, %v; want 0 with a frozen clock", res.Duration, res.Durations)
+	}
+	statuses, err := migrator.Status(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	if !statuses[0].AppliedAt.Equal(frozen) {
+		t.Errorf("AppliedAt = %v; want %v", statuses[0].AppliedAt, frozen)
+	}
+}
+
+func TestSqlx_PendingApplied(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("10_create_users", createUsersSql, dropUsersSql),
+			migrate.SqlxQueryMigration("2_create_courses", createCoursesSql, dropCoursesSql),
+		},
+	}
+	ids := func(migrations []migrate.SqlxMigration) []string {
+		var ret []string
+		for _, m := range migrations {
+			ret = append(ret, m.ID)
+		}
+		return ret
+	}
+	pending, err := migrator.Pending(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Pending() err = %v; want nil", err)
+	}
+	if got, want := ids(pending), []string{"2_create_courses", "10_create_users"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Pending() = %v; want %v", got, want)
+	}
+
+	err = migrator.MigrateN(db, "sqlite3", 1)
+	if err != nil {
+		t.Fatalf("MigrateN() err = %v; want nil", err)
+	}
+	pending, err = migrator.Pending(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Pending() err = %v; want nil", err)
+	}
+	if got, want := ids(pending), []string{"10_create_users"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Pending() = %v; want %v", got, want)
+	}
+	applied, err := migrator.Applied(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Applied() err = %v; want nil", err)
+	}
+	if got, want := ids(applied), []string{"2_create_courses"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Applied() = %v; want %v", got, want)
+	}
+}
+
+func TestSqlx_NextPending(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("10_create_users", createUsersSql, dropUsersSql),
+			migrate.SqlxQueryMigration("2_create_courses", createCoursesSql, dropCoursesSql),
+		},
+	}
+	for _, want := range []string{"2_create_courses", "10_create_users"} {
+		next, err := migrator.NextPending(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("NextPending() err = %v; want nil", err)
+		}
+		if next == nil || next.ID != want {
+			t.Fatalf("NextPending() = %v; want %q", next, want)
+		}
+		if want == "2_create_courses" && next.UpQuery != createCoursesSql {
+			t.Errorf("NextPending().UpQuery = %q; want %q", next.UpQuery, createCoursesSql)
+		}
+		err = migrator.MigrateN(db, "sqlite3", 1)
+		if err != nil {
+			t.Fatalf("MigrateN() err = %v; want nil", err)
+		}
+	}
+	next, err := migrator.NextPending(db, "sqlite3")
+	if next != nil || err != nil {
+		t.Errorf("NextPending() = %v, %v; want nil, nil", next, err)
+	}
+}
+
+func TestSqlx_Status_readOnly(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		},
+	}
+	statuses, err := migrator.Status(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	if len(statuses) != 1 || statuses[0].Applied {
+		t.Errorf("Status() = %+v; want one unapplied migration", statuses)
+	}
+	err = migrator.EnsureLatest(db, "sqlite3")
+	if !errors.Is(err, migrate.ErrPendingMigrations) {
+		t.Errorf("EnsureLatest() err = %v; want %v", err, migrate.ErrPendingMigrations)
+	}
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'migrations'").Scan(&count)
+	if err != nil {
+		t.Fatalf("QueryRow() err = %v; want nil", err)
+	}
+	if count != 0 {
+		t.Errorf("migrations table was created by a read-only operation")
+	}
+}
+
+func TestSqlx_Description(t *testing.T) {
+	db := sqliteInMem(t)
+	logger := &recordingLogger{}
+	m := migrate.SqlxQueryMigration("005_add_index", "CREATE INDEX courses_name ON courses (name);", "DROP INDEX courses_name;")
+	m.Description = "add index on course names"
+	migrator := migrate.Sqlx{
+		Logger: logger,
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			m,
+		},
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	var found bool
+	for _, e := range logger.entries {
+		if e.msg == "Running migration (2/2): 005_add_index — add index on course names" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("no progress message included the description")
+	}
+
+	// Once removed from the configured migrations, the recorded description
+	// is reported for the orphaned migration.
+	migrator.Migrations = migrator.Migrations[:1]
+	statuses, err := migrator.Status(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	if got := statuses[1]; !got.Orphaned || got.Description != "add index on course names" {
+		t.Errorf("Status()[1] = %+v; want an orphaned migration with its description", got)
+	}
+}
+
+func TestSqlx_Verify(t *testing.T) {
+	db := sqliteInMem(t)
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+			migrate.SqlxQueryMigration("003_create_widgets", "CREATE TABLE widgets (id int);", "DROP TABLE widgets;"),
+		},
+	}
+
+	// Nothing is created when the migrations table doesn't exist.
+	err := migrator.Verify(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Verify() err = %v; want nil", err)
+	}
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'migrations'").Scan(&count)
+	if err != nil {
+		t.Fatalf("QueryRow() err = %v; want nil", err)
+	}
+	if count != 0 {
+		t.Fatalf("migrations table exists; want Verify not to create it")
+	}
+
+	err = migrator.MigrateN(db, "sqlite3", 2)
+	if err != nil {
+		t.Fatalf("MigrateN() err = %v; want nil", err)
+	}
+	// A pending migration after every applied one is fine.
+	err = migrator.Verify(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Verify() err = %v; want nil", err)
+	}
+
+	_, err = db.Exec("INSERT INTO migrations (id) VALUES ('004_deleted'); DELETE FROM migrations WHERE id = '001_create_courses'; UPDATE migrations SET checksum = 'stale' WHERE id = '002_create_users';")
+	if err != nil {
+		t.Fatalf("db.Exec() err = %v; want nil", err)
+	}
+	err = migrator.Verify(db, "sqlite3")
+	for _, want := range []error{migrate.ErrChecksumMismatch, migrate.ErrOrphanedMigration, migrate.ErrOutOfOrder} {
+		if !errors.Is(err, want) {
+			t.Errorf("Verify() err = %v; want it to include %v", err, want)
+		}
+	}
+	if errors.Is(err, migrate.ErrDirtyState) {
+		t.Errorf("Verify() err = %v; want no %v", err, migrate.ErrDirtyState)
+	}
+	statuses, err := migrator.Status(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	if len(statuses) != 4 || statuses[0].Applied {
+		t.Errorf("Status() = %+v; want Verify to leave the records unchanged", statuses)
+	}
+}
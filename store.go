@@ -0,0 +1,725 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AppliedMigration is the record a Store keeps of a migration that has been
+// run.
+type AppliedMigration struct {
+	ID string
+	// Checksum is a SHA-256 of the migration's SQL, or empty if the migration
+	// didn't have any SQL.
+	Checksum string
+	// AppliedAt is when the migration was run. It may be the zero time for
+	// migrations recorded by older versions of this package.
+	AppliedAt time.Time
+	// Dirty is true when a non-transactional migration failed partway
+	// through. See ErrDirtyState.
+	Dirty bool
+	// Description is the migration's Description when it was run.
+	Description string
+	// AppliedBy identifies the build that ran the migration, as set by
+	// Sqlx.AppliedBy. It is empty if none was set or the Store doesn't keep
+	// it.
+	AppliedBy string
+}
+
+// Store keeps track of which migrations have been run. Methods that change
+// what has been recorded are passed ex, which is the transaction the
+// migration is being run in, or the database itself for migrations run
+// outside of a transaction. Stores that keep their records in the database
+// should use ex so that their changes are committed or rolled back along with
+// the migration. For transactional migrations Insert and Delete are only
+// called once the migration itself has succeeded, and never during a dry run.
+type Store interface {
+	// EnsureTable creates whatever the Store needs to keep its records, such
+	// as a table, if it doesn't already exist.
+	EnsureTable(ctx context.Context, db *sqlx.DB) error
+	// Applied returns every migration that has been recorded as run.
+	Applied(ctx context.Context, db *sqlx.DB) ([]AppliedMigration, error)
+	// Insert records a migration as run.
+	Insert(ctx context.Context, ex sqlx.ExtContext, rec AppliedMigration) error
+	// Delete removes the record of a migration having been run.
+	Delete(ctx context.Context, ex sqlx.ExtContext, id string) error
+	// SetDirty updates the Dirty field of a recorded migration, returning
+	// ErrMigrationNotFound if there is no record with the provided id.
+	SetDirty(ctx context.Context, ex sqlx.ExtContext, id string, dirty bool) error
+}
+
+// BatchInserter is implemented by Stores that can record several migrations
+// at once. When SingleTransaction is set the records of every migration run
+// are collected and passed to InsertBatch just before the transaction is
+// committed, rather than inserted one at a time, which is noticeably faster
+// when hundreds of migrations are applied to an empty database. Insert is
+// called for each record instead for Stores that don't implement it.
+//
+// Note: a Store that embeds SQLStore and overrides Insert should override
+// InsertBatch as well, since SQLStore's InsertBatch is used otherwise.
+type BatchInserter interface {
+	InsertBatch(ctx context.Context, ex sqlx.ExtContext, recs []AppliedMigration) error
+}
+
+// TableChecker is implemented by Stores that can report whether their table
+// exists without creating it. Read-only operations such as Status use it so
+// that they work for database users without DDL privileges, treating a
+// missing table as nothing having been applied. Rollback uses it in the same
+// way to avoid creating the table on a fresh database. EnsureTable is called
+// instead for Stores that don't implement it.
+type TableChecker interface {
+	TableExists(ctx context.Context, db *sqlx.DB) (bool, error)
+}
+
+// TableDropper is implemented by Stores that can remove whatever EnsureTable
+// created. Sqlx.DropTableOnEmpty uses it to drop the table once every
+// migration has been rolled back.
+type TableDropper interface {
+	DropTable(ctx context.Context, db *sqlx.DB) error
+}
+
+// SQLStore is a Store that keeps its records in a table in the database being
+// migrated. It is the Store used by Sqlx when one isn't provided.
+type SQLStore struct {
+	// TableName is the name of the migrations table. If empty it will default
+	// to "migrations". Because the table name can't be passed in as a bound
+	// parameter it may only contain letters, numbers, and underscores.
+	//
+	// The name may be qualified with a schema, such as "meta.migrations". Each
+	// part of a qualified name is quoted for the dialect, so on Postgres it
+	// is case sensitive. Unqualified names are left unquoted.
+	TableName string
+	// IDColumn is the name of the column migration IDs are stored in. If
+	// empty it will default to "id". It is subject to the same restrictions
+	// as TableName, except that it can't be qualified. Setting it, along with
+	// NumericIDs, allows an existing migrations table with a column such as
+	// "version BIGINT" to be adopted. Any missing columns are added to the
+	// table, and existing rows are left as they are.
+	IDColumn string
+	// NumericIDs causes migration IDs to be stored as BIGINT rather than
+	// text. Every migration ID must then be an integer written without
+	// leading zeros, such as "20240115093000", so that it reads back from the
+	// table exactly as it was configured.
+	NumericIDs bool
+	// AppliedByColumn adds an applied_by column to the table, which keeps the
+	// AppliedBy of each record. It is left out by default to keep the table
+	// minimal, and records read without it have an empty AppliedBy.
+	AppliedByColumn bool
+}
+
+// EnsureTable implements Store. Errors saying the table already exists are
+// ignored, since they mean another process created it first.
+func (st *SQLStore) EnsureTable(ctx context.Context, db *sqlx.DB) error {
+	table, err := st.tableName(db.DriverName())
+	if err != nil {
+		return err
+	}
+	idColumn, err := st.idColumn()
+	if err != nil {
+		return err
+	}
+	types := columnTypesFor(db.DriverName())
+	idType := types.key
+	if st.NumericIDs {
+		idType = "BIGINT"
+	}
+	columns := idColumn + " " + idType + " PRIMARY KEY, checksum " + types.text + ", applied_at " + types.timestamp + ", dirty " + types.boolean + ", description " + types.text
+	_, err = db.ExecContext(ctx, createTableSQL(db.DriverName(), table, columns))
+	if err != nil && !isAlreadyExists(err) {
+		return fmt.Errorf("creating migrations table: %w", err)
+	}
+	err = st.addColumnIfMissing(ctx, db, table, "checksum", types.text)
+	if err != nil {
+		return err
+	}
+	err = st.addColumnIfMissing(ctx, db, table, "applied_at", types.timestamp)
+	if err != nil {
+		return err
+	}
+	err = st.addColumnIfMissing(ctx, db, table, "dirty", types.boolean)
+	if err != nil {
+		return err
+	}
+	err = st.addColumnIfMissing(ctx, db, table, "description", types.text)
+	if err != nil {
+		return err
+	}
+	if st.AppliedByColumn {
+		return st.addColumnIfMissing(ctx, db, table, "applied_by", types.text)
+	}
+	return nil
+}
+
+// DropTable implements TableDropper.
+func (st *SQLStore) DropTable(ctx context.Context, db *sqlx.DB) error {
+	table, err := st.tableName(db.DriverName())
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "DROP TABLE "+table)
+	return err
+}
+
+// TableExists implements TableChecker.
+func (st *SQLStore) TableExists(ctx context.Context, db *sqlx.DB) (bool, error) {
+	schema, table, err := st.splitTableName()
+	if err != nil {
+		return false, err
+	}
+	dialect := db.DriverName()
+	var query string
+	args := []interface{}{table}
+	switch {
+	case dialect == "sqlite3":
+		master := "sqlite_master"
+		if schema != "" {
+			master = quoteIdent(dialect, schema) + ".sqlite_master"
+		}
+		query = "SELECT COUNT(*) FROM " + master + " WHERE type = 'table' AND name = ?"
+	case schema != "":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ? AND table_schema = ?"
+		args = append(args, schema)
+	case dialect == "mysql":
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ? AND table_schema = DATABASE()"
+	case postgresDialects[dialect]:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ? AND table_schema = current_schema()"
+	default:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_name = ?"
+	}
+	var n int
+	err = db.QueryRowxContext(ctx, db.Rebind(query), args...).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("checking for migrations table: %w", err)
+	}
+	return n > 0, nil
+}
+
+// addColumnIfMissing adds a column to migrations tables that were created by
+// older versions of this package. Another process adding the same column at
+// the same time isn't treated as an error.
+func (st *SQLStore) addColumnIfMissing(ctx context.Context, db *sqlx.DB, table, column, columnType string) error {
+	rows, err := db.QueryContext(ctx, "SELECT "+column+" FROM "+table+" WHERE 1=0")
+	if err == nil {
+		return rows.Close()
+	}
+	_, err = db.ExecContext(ctx, addColumnSQL(db.DriverName(), table, column, columnType))
+	if err != nil && !isAlreadyExists(err) {
+		return fmt.Errorf("adding %s column to migrations table: %w", column, err)
+	}
+	return nil
+}
+
+// Applied implements Store.
+func (st *SQLStore) Applied(ctx context.Context, db *sqlx.DB) ([]AppliedMigration, error) {
+	table, err := st.tableName(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	idColumn, err := st.idColumn()
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID          string       `db:"id"`
+		Checksum    string       `db:"checksum"`
+		AppliedAt   nullTime     `db:"applied_at"`
+		Dirty       sql.NullBool `db:"dirty"`
+		Description string       `db:"description"`
+		AppliedBy   string       `db:"applied_by"`
+	}
+	if idColumn != "id" {
+		idColumn += " AS id"
+	}
+	appliedBy := "'' AS applied_by"
+	if st.AppliedByColumn {
+		appliedBy = "COALESCE(applied_by, '') AS applied_by"
+	}
+	err = db.SelectContext(ctx, &rows, "SELECT "+idColumn+", COALESCE(checksum, '') AS checksum, applied_at, dirty, COALESCE(description, '') AS description, "+appliedBy+" FROM "+table)
+	if err != nil {
+		return nil, fmt.Errorf("looking up applied migrations: %w", err)
+	}
+	applied := make([]AppliedMigration, 0, len(rows))
+	for _, row := range rows {
+		applied = append(applied, AppliedMigration{
+			ID:          row.ID,
+			Checksum:    row.Checksum,
+			AppliedAt:   row.AppliedAt.Time,
+			Dirty:       row.Dirty.Bool,
+			Description: row.Description,
+			AppliedBy:   row.AppliedBy,
+		})
+	}
+	return applied, nil
+}
+
+// Insert implements Store.
+func (st *SQLStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec AppliedMigration) error {
+	table, idColumn, id, err := st.names(ex.DriverName(), rec.ID)
+	if err != nil {
+		return err
+	}
+	_, err = ex.ExecContext(ctx, ex.Rebind(st.insertSQL(table, idColumn, 1)), st.insertArgs(nil, id, rec)...)
+	return err
+}
+
+// insertSQL returns a statement inserting n records into table.
+func (st *SQLStore) insertSQL(table, idColumn string, n int) string {
+	columns := idColumn + ", checksum, applied_at, dirty, description"
+	row := "(?, ?, ?, ?, ?)"
+	if st.AppliedByColumn {
+		columns += ", applied_by"
+		row = "(?, ?, ?, ?, ?, ?)"
+	}
+	return "INSERT INTO " + table + " (" + columns + ") VALUES " + strings.TrimSuffix(strings.Repeat(row+", ", n), ", ")
+}
+
+// insertArgs appends the values inserted for rec to args, using key as its
+// ID.
+func (st *SQLStore) insertArgs(args []interface{}, key interface{}, rec AppliedMigration) []interface{} {
+	args = append(args, key, sql.NullString{String: rec.Checksum, Valid: rec.Checksum != ""}, rec.AppliedAt, rec.Dirty,
+		sql.NullString{String: rec.Description, Valid: rec.Description != ""})
+	if st.AppliedByColumn {
+		args = append(args, sql.NullString{String: rec.AppliedBy, Valid: rec.AppliedBy != ""})
+	}
+	return args
+}
+
+// deleteSQL returns a statement deleting a record from table by its ID.
+func deleteSQL(table, idColumn string) string {
+	return "DELETE FROM " + table + " WHERE " + idColumn + "=?"
+}
+
+// insertBatchSize is the most rows InsertBatch puts in a single statement,
+// keeping the number of bound parameters well under the limits of every
+// supported database.
+const insertBatchSize = 100
+
+// InsertBatch implements BatchInserter using multi-row INSERT statements.
+func (st *SQLStore) InsertBatch(ctx context.Context, ex sqlx.ExtContext, recs []AppliedMigration) error {
+	for len(recs) > 0 {
+		n := len(recs)
+		if n > insertBatchSize {
+			n = insertBatchSize
+		}
+		var table, idColumn string
+		args := make([]interface{}, 0, n*6)
+		for _, rec := range recs[:n] {
+			var id interface{}
+			var err error
+			table, idColumn, id, err = st.names(ex.DriverName(), rec.ID)
+			if err != nil {
+				return err
+			}
+			args = st.insertArgs(args, id, rec)
+		}
+		_, err := ex.ExecContext(ctx, ex.Rebind(st.insertSQL(table, idColumn, n)), args...)
+		if err != nil {
+			return err
+		}
+		recs = recs[n:]
+	}
+	return nil
+}
+
+// Delete implements Store.
+func (st *SQLStore) Delete(ctx context.Context, ex sqlx.ExtContext, id string) error {
+	table, idColumn, key, err := st.names(ex.DriverName(), id)
+	if err != nil {
+		return err
+	}
+	_, err = ex.ExecContext(ctx, ex.Rebind(deleteSQL(table, idColumn)), key)
+	return err
+}
+
+// SetDirty implements Store.
+func (st *SQLStore) SetDirty(ctx context.Context, ex sqlx.ExtContext, id string, dirty bool) error {
+	table, idColumn, key, err := st.names(ex.DriverName(), id)
+	if err != nil {
+		return err
+	}
+	res, err := ex.ExecContext(ctx, ex.Rebind("UPDATE "+table+" SET dirty=? WHERE "+idColumn+"=?"), dirty, key)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err == nil && n == 0 {
+		return fmt.Errorf("%w: %q", ErrMigrationNotFound, id)
+	}
+	return nil
+}
+
+// tableName returns the name of the migrations table for use in SQL,
+// falling back to the default when TableName isn't set.
+func (st *SQLStore) tableName(dialect string) (string, error) {
+	schema, table, err := st.splitTableName()
+	if err != nil {
+		return "", err
+	}
+	if schema == "" {
+		return table, nil
+	}
+	return quoteIdent(dialect, schema) + "." + quoteIdent(dialect, table), nil
+}
+
+// idColumn returns the name of the ID column, falling back to the default
+// when IDColumn isn't set.
+func (st *SQLStore) idColumn() (string, error) {
+	if st.IDColumn == "" {
+		return "id", nil
+	}
+	if !validTableName.MatchString(st.IDColumn) {
+		return "", fmt.Errorf("invalid migrations id column name: %q", st.IDColumn)
+	}
+	return st.IDColumn, nil
+}
+
+// names returns the table name and ID column for use in SQL, along with id
+// converted to the value stored in the ID column.
+func (st *SQLStore) names(dialect, id string) (table, idColumn string, key interface{}, err error) {
+	table, err = st.tableName(dialect)
+	if err != nil {
+		return "", "", nil, err
+	}
+	idColumn, err = st.idColumn()
+	if err != nil {
+		return "", "", nil, err
+	}
+	if !st.NumericIDs {
+		return table, idColumn, id, nil
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != id {
+		return "", "", nil, fmt.Errorf("migration id %q must be an integer without leading zeros when NumericIDs is set", id)
+	}
+	return table, idColumn, n, nil
+}
+
+// splitTableName validates TableName and splits it into its schema, which
+// is empty for unqualified names, and table.
+func (st *SQLStore) splitTableName() (schema, table string, err error) {
+	if st.TableName == "" {
+		return "", defaultTableName, nil
+	}
+	table = st.TableName
+	if i := strings.IndexByte(table, '.'); i >= 0 {
+		schema, table = table[:i], table[i+1:]
+		if !validTableName.MatchString(schema) {
+			return "", "", fmt.Errorf("invalid migrations table name: %q", st.TableName)
+		}
+	}
+	if !validTableName.MatchString(table) {
+		return "", "", fmt.Errorf("invalid migrations table name: %q", st.TableName)
+	}
+	return schema, table, nil
+}
+
+// nullTime scans a possibly NULL timestamp. Unlike sql.NullTime it also
+// accepts timestamps returned as text, which is how the MySQL driver returns
+// them unless parseTime=true is set in the DSN, and how SQLite returns them
+// for columns it doesn't recognize as timestamps.
+type nullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// Scan implements sql.Scanner.
+func (nt *nullTime) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		*nt = nullTime{}
+		return nil
+	case time.Time:
+		*nt = nullTime{Time: v, Valid: true}
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("scanning applied_at: unsupported type %T", src)
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999", "2006-01-02 15:04:05.999999999-07:00", time.RFC3339Nano} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			*nt = nullTime{Time: t, Valid: true}
+			return nil
+		}
+	}
+	return fmt.Errorf("scanning applied_at: unsupported format %q", s)
+}
+
+// InMemoryStore is a Store that keeps its records in memory rather than in
+// the database. It is intended for tests that want to check which migrations
+// were run without inspecting a migrations table. Because records aren't
+// part of the migration's transaction, an InMemoryStore won't notice if a
+// transaction fails to commit.
+//
+// The zero value is ready to use, and an InMemoryStore is safe for
+// concurrent use.
+type InMemoryStore struct {
+	mu      sync.Mutex
+	applied map[string]AppliedMigration
+}
+
+// EnsureTable implements Store. It does nothing.
+func (st *InMemoryStore) EnsureTable(ctx context.Context, db *sqlx.DB) error {
+	return nil
+}
+
+// Applied implements Store. Records are returned sorted by ID.
+func (st *InMemoryStore) Applied(ctx context.Context, db *sqlx.DB) ([]AppliedMigration, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	applied := make([]AppliedMigration, 0, len(st.applied))
+	for _, rec := range st.applied {
+		applied = append(applied, rec)
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return CompareIDs(applied[i].ID, applied[j].ID) < 0
+	})
+	return applied, nil
+}
+
+// Insert implements Store.
+func (st *InMemoryStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec AppliedMigration) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.applied[rec.ID]; ok {
+		return fmt.Errorf("%w: %q", ErrDuplicateID, rec.ID)
+	}
+	if st.applied == nil {
+		st.applied = make(map[string]AppliedMigration)
+	}
+	st.applied[rec.ID] = rec
+	return nil
+}
+
+// Delete implements Store.
+func (st *InMemoryStore) Delete(ctx context.Context, ex sqlx.ExtContext, id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	delete(st.applied, id)
+	return nil
+}
+
+// SetDirty implements Store.
+func (st *InMemoryStore) SetDirty(ctx context.Context, ex sqlx.ExtContext, id string, dirty bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	rec, ok := st.applied[id]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrMigrationNotFound, id)
+	}
+	rec.Dirty = dirty
+	st.applied[id] = rec
+	return nil
+}
+
+// IDs returns the IDs of every recorded migration in order.
+func (st *InMemoryStore) IDs() []string {
+	applied, _ := st.Applied(context.Background(), nil)
+	ids := make([]string, 0, len(applied))
+	for _, rec := range applied {
+		ids = append(ids, rec.ID)
+	}
+	return ids
+}
+
+// preparedStore wraps a SQLStore, running Insert and Delete with statements
+// prepared once rather than having the database parse them for every
+// migration. ex must be db or a transaction begun on it.
+type preparedStore struct {
+	*SQLStore
+	db             *sqlx.DB
+	insert, delete *sqlx.Stmt
+}
+
+// prepareStatements prepares the statements used by Insert and Delete on db.
+func (st *SQLStore) prepareStatements(ctx context.Context, db *sqlx.DB) (*preparedStore, error) {
+	table, err := st.tableName(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	idColumn, err := st.idColumn()
+	if err != nil {
+		return nil, err
+	}
+	ps := &preparedStore{SQLStore: st, db: db}
+	ps.insert, err = db.PreparexContext(ctx, db.Rebind(st.insertSQL(table, idColumn, 1)))
+	if err != nil {
+		return nil, err
+	}
+	ps.delete, err = db.PreparexContext(ctx, db.Rebind(deleteSQL(table, idColumn)))
+	if err != nil {
+		ps.insert.Close()
+		return nil, err
+	}
+	return ps, nil
+}
+
+// Insert implements Store.
+func (ps *preparedStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec AppliedMigration) error {
+	_, _, id, err := ps.names(ex.DriverName(), rec.ID)
+	if err != nil {
+		return err
+	}
+	_, err = ps.stmt(ctx, ex, ps.insert).ExecContext(ctx, ps.insertArgs(nil, id, rec)...)
+	return err
+}
+
+// Delete implements Store.
+func (ps *preparedStore) Delete(ctx context.Context, ex sqlx.ExtContext, id string) error {
+	_, _, key, err := ps.names(ex.DriverName(), id)
+	if err != nil {
+		return err
+	}
+	_, err = ps.stmt(ctx, ex, ps.delete).ExecContext(ctx, key)
+	return err
+}
+
+// stmt returns stmt for use with ex, which is either db or a transaction.
+func (ps *preparedStore) stmt(ctx context.Context, ex sqlx.ExtContext, stmt *sqlx.Stmt) *sqlx.Stmt {
+	if tx, ok := ex.(*sqlx.Tx); ok {
+		return tx.StmtxContext(ctx, stmt)
+	}
+	return stmt
+}
+
+// close closes the prepared statements.
+func (ps *preparedStore) close() {
+	ps.insert.Close()
+	ps.delete.Close()
+}
+
+// funcStore is the Store used when Sqlx.IsApplied is set, keeping track of
+// migrations with the provided functions rather than a table of its own.
+type funcStore struct {
+	// ids are the IDs of the configured migrations, which are the only ones
+	// isApplied can be asked about.
+	ids              []string
+	isApplied        func(db *sqlx.DB, id string) (bool, error)
+	recordApplied    func(ex sqlx.ExtContext, id string) error
+	recordRolledBack func(ex sqlx.ExtContext, id string) error
+}
+
+// EnsureTable implements Store. It does nothing, since the migration state
+// is kept elsewhere.
+func (st *funcStore) EnsureTable(ctx context.Context, db *sqlx.DB) error {
+	return nil
+}
+
+// Applied implements Store, asking about each configured migration in turn.
+func (st *funcStore) Applied(ctx context.Context, db *sqlx.DB) ([]AppliedMigration, error) {
+	var applied []AppliedMigration
+	for _, id := range st.ids {
+		ok, err := st.isApplied(db, id)
+		if err != nil {
+			return nil, fmt.Errorf("checking whether %q is applied: %w", id, err)
+		}
+		if ok {
+			applied = append(applied, AppliedMigration{ID: id})
+		}
+	}
+	return applied, nil
+}
+
+// Insert implements Store. Dirty records, which are inserted before a
+// non-transactional migration is run, aren't recorded until SetDirty clears
+// them once it has succeeded.
+func (st *funcStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec AppliedMigration) error {
+	if rec.Dirty {
+		return nil
+	}
+	return st.recordApplied(ex, rec.ID)
+}
+
+// Delete implements Store.
+func (st *funcStore) Delete(ctx context.Context, ex sqlx.ExtContext, id string) error {
+	if st.recordRolledBack == nil {
+		return errors.New("RecordRolledBack must be set to roll back migrations")
+	}
+	return st.recordRolledBack(ex, id)
+}
+
+// SetDirty implements Store. Clearing the dirty state records a
+// non-transactional migration as applied once it has succeeded, while setting
+// it does nothing.
+func (st *funcStore) SetDirty(ctx context.Context, ex sqlx.ExtContext, id string, dirty bool) error {
+	if dirty {
+		return nil
+	}
+	return st.recordApplied(ex, id)
+}
+
+// emptyStore is the Store used for a dry run when the migrations table
+// doesn't exist. It has no records and ignores writes, since a dry run
+// mustn't create the table to write them to.
+type emptyStore struct{}
+
+// EnsureTable implements Store.
+func (emptyStore) EnsureTable(ctx context.Context, db *sqlx.DB) error {
+	return nil
+}
+
+// Applied implements Store.
+func (emptyStore) Applied(ctx context.Context, db *sqlx.DB) ([]AppliedMigration, error) {
+	return nil, nil
+}
+
+// Insert implements Store.
+func (emptyStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec AppliedMigration) error {
+	return nil
+}
+
+// Delete implements Store.
+func (emptyStore) Delete(ctx context.Context, ex sqlx.ExtContext, id string) error {
+	return nil
+}
+
+// SetDirty implements Store.
+func (emptyStore) SetDirty(ctx context.Context, ex sqlx.ExtContext, id string, dirty bool) error {
+	return nil
+}
+
+// batchStore wraps a Store, holding on to the records passed to Insert until
+// flush is called so that they can be inserted together.
+type batchStore struct {
+	Store
+	pending []AppliedMigration
+}
+
+// Insert implements Store.
+func (bs *batchStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec AppliedMigration) error {
+	bs.pending = append(bs.pending, rec)
+	return nil
+}
+
+// flush inserts every pending record using ex, with InsertBatch if the
+// wrapped Store implements BatchInserter.
+func (bs *batchStore) flush(ctx context.Context, ex sqlx.ExtContext) error {
+	recs := bs.pending
+	bs.pending = nil
+	if len(recs) == 0 {
+		return nil
+	}
+	if bi, ok := bs.Store.(BatchInserter); ok {
+		return bi.InsertBatch(ctx, ex, recs)
+	}
+	for _, rec := range recs {
+		err := bs.Store.Insert(ctx, ex, rec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,462 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/joncalhoun/migrate"
+	"github.com/mattn/go-sqlite3"
+)
+
+// recordingStore wraps a SQLStore, recording the IDs passed to Insert and
+// Delete.
+type recordingStore struct {
+	migrate.SQLStore
+	inserted []string
+	deleted  []string
+}
+
+func (rs *recordingStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec migrate.AppliedMigration) error {
+	rs.inserted = append(rs.inserted, rec.ID)
+	return rs.SQLStore.Insert(ctx, ex, rec)
+}
+
+func (rs *recordingStore) Delete(ctx context.Context, ex sqlx.ExtContext, id string) error {
+	rs.deleted = append(rs.deleted, id)
+	return rs.SQLStore.Delete(ctx, ex, id)
+}
+
+func TestSqlx_Store(t *testing.T) {
+	db := sqliteInMem(t)
+	store := &recordingStore{SQLStore: migrate.SQLStore{TableName: "custom_store"}}
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		},
+		Store: store,
+	}
+	err := migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	want := []string{"001_create_courses", "002_create_users"}
+	if !reflect.DeepEqual(store.inserted, want) {
+		t.Errorf("inserted = %v; want %v", store.inserted, want)
+	}
+	var ids []string
+	err = sqlx.NewDb(db, "sqlite3").Select(&ids, "SELECT id FROM custom_store ORDER BY id")
+	if err != nil {
+		t.Fatalf("Select() err = %v; want nil", err)
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("custom_store ids = %v; want %v", ids, want)
+	}
+
+	err = migrator.Rollback(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Rollback() err = %v; want nil", err)
+	}
+	want = []string{"002_create_users", "001_create_courses"}
+	if !reflect.DeepEqual(store.deleted, want) {
+		t.Errorf("deleted = %v; want %v", store.deleted, want)
+	}
+}
+
+// noopDriver is a database/sql driver whose transactions do nothing, so that
+// migrations that don't run any SQL can be tested without a real database.
+type noopDriver struct{}
+
+func (noopDriver) Open(name string) (driver.Conn, error) { return noopConn{}, nil }
+
+type noopConn struct{}
+
+func (noopConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("noop: queries are not supported")
+}
+func (noopConn) Close() error              { return nil }
+func (noopConn) Begin() (driver.Tx, error) { return noopTx{}, nil }
+
+type noopTx struct{}
+
+func (noopTx) Commit() error   { return nil }
+func (noopTx) Rollback() error { return nil }
+
+func init() {
+	sql.Register("migrate_noop", noopDriver{})
+}
+
+func TestInMemoryStore(t *testing.T) {
+	db, err := sql.Open("migrate_noop", "")
+	if err != nil {
+		t.Fatalf("Open() err = %v; want nil", err)
+	}
+	defer db.Close()
+
+	var ran []string
+	fake := func(id string) migrate.SqlxMigration {
+		return migrate.SqlxMigration{
+			ID: id,
+			Migrate: func(tx *sqlx.Tx) error {
+				ran = append(ran, id)
+				return nil
+			},
+			Rollback: func(tx *sqlx.Tx) error {
+				ran = append(ran, "-"+id)
+				return nil
+			},
+		}
+	}
+	store := &migrate.InMemoryStore{}
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			fake("1_first"),
+			fake("2_second"),
+			fake("10_third"),
+		},
+		Store: store,
+	}
+
+	err = migrator.MigrateN(db, "sqlite3", 2)
+	if err != nil {
+		t.Fatalf("MigrateN() err = %v; want nil", err)
+	}
+	want := []string{"1_first", "2_second"}
+	if got := store.IDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs() = %v; want %v", got, want)
+	}
+	if !reflect.DeepEqual(ran, want) {
+		t.Errorf("ran = %v; want %v", ran, want)
+	}
+
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	want = []string{"1_first", "2_second", "10_third"}
+	if got := store.IDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs() = %v; want %v", got, want)
+	}
+
+	err = migrator.RollbackN(db, "sqlite3", 1)
+	if err != nil {
+		t.Fatalf("RollbackN() err = %v; want nil", err)
+	}
+	want = []string{"1_first", "2_second"}
+	if got := store.IDs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("IDs() = %v; want %v", got, want)
+	}
+	wantRan := []string{"1_first", "2_second", "10_third", "-10_third"}
+	if !reflect.DeepEqual(ran, wantRan) {
+		t.Errorf("ran = %v; want %v", ran, wantRan)
+	}
+}
+
+func TestSqlx_SchemaQualifiedTableName(t *testing.T) {
+	db := sqliteInMem(t)
+	// ATTACH only applies to the connection it is run on.
+	db.SetMaxOpenConns(1)
+	_, err := db.Exec(fmt.Sprintf("ATTACH DATABASE 'file:%s_meta?mode=memory&cache=shared' AS meta", t.Name()))
+	if err != nil {
+		t.Fatalf("db.Exec() err = %v; want nil", err)
+	}
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+			migrate.SqlxQueryMigration("002_create_users", createUsersSql, dropUsersSql),
+		},
+		TableName: "meta.schema_versions",
+	}
+	statuses, err := migrator.Status(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	if statuses[0].Applied {
+		t.Errorf("Applied = true; want false before migrating")
+	}
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	err = migrator.RollbackN(db, "sqlite3", 1)
+	if err != nil {
+		t.Fatalf("RollbackN() err = %v; want nil", err)
+	}
+	var ids []string
+	err = sqlx.NewDb(db, "sqlite3").Select(&ids, "SELECT id FROM meta.schema_versions")
+	if err != nil {
+		t.Fatalf("Select() err = %v; want nil", err)
+	}
+	if want := []string{"001_create_courses"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v; want %v", ids, want)
+	}
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM main.sqlite_master WHERE name = 'schema_versions'").Scan(&count)
+	if err != nil {
+		t.Fatalf("QueryRow() err = %v; want nil", err)
+	}
+	if count != 0 {
+		t.Errorf("schema_versions was created in the main schema")
+	}
+
+	for _, name := range []string{"a.b.c", ".migrations", "meta.", "meta;.x"} {
+		migrator.TableName = name
+		err = migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Errorf("Migrate() with TableName %q err = nil; want an error", name)
+		}
+	}
+}
+
+// racingDriver wraps the sqlite3 driver so that every CREATE TABLE IF NOT
+// EXISTS and ALTER TABLE statement fails after it runs, as though another
+// process had made the same change first on a database where those
+// statements aren't atomic.
+type racingDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *racingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return racingConn{conn}, nil
+}
+
+type racingConn struct {
+	driver.Conn
+}
+
+func (c racingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	res, err := c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE IF NOT EXISTS "):
+		return nil, errors.New("table migrations already exists")
+	case strings.HasPrefix(query, "ALTER TABLE "):
+		return nil, errors.New("duplicate column name: description")
+	}
+	return res, nil
+}
+
+func init() {
+	sql.Register("migrate_racing", &racingDriver{})
+}
+
+func TestSQLStoreConcurrentCreate(t *testing.T) {
+	db, err := sql.Open("migrate_racing", fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()))
+	if err != nil {
+		t.Fatalf("Open() err = %v; want nil", err)
+	}
+	defer db.Close()
+	// An older migrations table is missing the newer columns, so they are
+	// added with ALTER TABLE as well.
+	_, err = db.Exec("CREATE TABLE migrations (id TEXT PRIMARY KEY)")
+	if err != nil {
+		t.Fatalf("Exec() err = %v; want nil", err)
+	}
+
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			migrate.SqlxQueryMigration("001_create_courses", createCoursesSql, dropCoursesSql),
+		},
+		HistoryTable: "migration_history",
+	}
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	statuses, err := migrator.Status(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Status() err = %v; want nil", err)
+	}
+	if len(statuses) != 1 || !statuses[0].Applied {
+		t.Errorf("Status() = %+v; want 001_create_courses applied", statuses)
+	}
+}
+
+func TestSQLStore_IDColumn(t *testing.T) {
+	db := sqliteInMem(t)
+	// An existing bookkeeping table from another tool.
+	_, err := db.Exec("CREATE TABLE schema_versions (version BIGINT PRIMARY KEY); INSERT INTO schema_versions (version) VALUES (20240101000000);")
+	if err != nil {
+		t.Fatalf("Exec() err = %v; want nil", err)
+	}
+	var ran []string
+	migrator := migrate.Sqlx{
+		Printf: func(format string, args ...interface{}) (int, error) {
+			t.Logf(format, args...)
+			return 0, nil
+		},
+		Migrations: []migrate.SqlxMigration{
+			{ID: "20240101000000", Migrate: func(tx *sqlx.Tx) error {
+				ran = append(ran, "20240101000000")
+				return nil
+			}},
+			migrate.SqlxQueryMigration("20240201000000", createCoursesSql, dropCoursesSql),
+		},
+		TableName:  "schema_versions",
+		IDColumn:   "version",
+		NumericIDs: true,
+	}
+	err = migrator.Validate()
+	if err != nil {
+		t.Fatalf("Validate() err = %v; want nil", err)
+	}
+	err = migrator.Migrate(db, "sqlite3")
+	if err != nil {
+		t.Fatalf("Migrate() err = %v; want nil", err)
+	}
+	if len(ran) != 0 {
+		t.Errorf("ran = %v; want the already recorded migration to be skipped", ran)
+	}
+	versions := func() []int64 {
+		var versions []int64
+		err := sqlx.NewDb(db, "sqlite3").Select(&versions, "SELECT version FROM schema_versions ORDER BY version")
+		if err != nil {
+			t.Fatalf("Select() err = %v; want nil", err)
+		}
+		return versions
+	}
+	if got, want := versions(), []int64{20240101000000, 20240201000000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+
+	err = migrator.RollbackN(db, "sqlite3", 1)
+	if err != nil {
+		t.Fatalf("RollbackN() err = %v; want nil", err)
+	}
+	if got, want := versions(), []int64{20240101000000}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %v; want %v", got, want)
+	}
+
+	migrator.Migrations = append(migrator.Migrations, migrate.SqlxQueryMigration("003_create_users", createUsersSql, dropUsersSql))
+	err = migrator.Migrate(db, "sqlite3")
+	if err == nil || !strings.Contains(err.Error(), "003_create_users") {
+		t.Errorf("Migrate() err = %v; want an error about the non-numeric id", err)
+	}
+
+	migrator.IDColumn = "version; DROP TABLE courses"
+	err = migrator.Validate()
+	if err == nil {
+		t.Errorf("Validate() err = nil; want an error for the id column name")
+	}
+}
+
+// batchRecordingStore wraps a SQLStore, recording the IDs passed to Insert
+// and each call to InsertBatch.
+type batchRecordingStore struct {
+	migrate.SQLStore
+	inserted []string
+	batches  [][]string
+}
+
+func (bs *batchRecordingStore) Insert(ctx context.Context, ex sqlx.ExtContext, rec migrate.AppliedMigration) error {
+	bs.inserted = append(bs.inserted, rec.ID)
+	return bs.SQLStore.Insert(ctx, ex, rec)
+}
+
+func (bs *batchRecordingStore) InsertBatch(ctx context.Context, ex sqlx.ExtContext, recs []migrate.AppliedMigration) error {
+	var ids []string
+	for _, rec := range recs {
+		ids = append(ids, rec.ID)
+	}
+	bs.batches = append(bs.batches, ids)
+	return bs.SQLStore.InsertBatch(ctx, ex, recs)
+}
+
+func TestSQLStore_InsertBatch(t *testing.T) {
+	// More migrations than fit in a single INSERT statement.
+	var migrations []migrate.SqlxMigration
+	var ids []string
+	for i := 1; i <= 250; i++ {
+		id := fmt.Sprintf("%03d_create_table", i)
+		migrations = append(migrations, migrate.SqlxQueryMigration(id, fmt.Sprintf("CREATE TABLE t%d (id int);", i), ""))
+		ids = append(ids, id)
+	}
+	newMigrator := func(store migrate.Store, migrations []migrate.SqlxMigration) *migrate.Sqlx {
+		return migrate.NewSqlx(migrations, migrate.WithSilent(), func(s *migrate.Sqlx) error {
+			s.Store = store
+			return nil
+		})
+	}
+
+	t.Run("single transaction", func(t *testing.T) {
+		db := sqliteInMem(t)
+		store := &batchRecordingStore{}
+		migrator := newMigrator(store, migrations)
+		migrator.SingleTransaction = true
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		if len(store.inserted) != 0 {
+			t.Errorf("inserted = %v; want every record inserted in a batch", store.inserted)
+		}
+		if len(store.batches) != 1 || !reflect.DeepEqual(store.batches[0], ids) {
+			t.Errorf("batches = %v; want one batch of every migration", store.batches)
+		}
+		assertApplied(t, db, ids...)
+	})
+
+	t.Run("savepoints", func(t *testing.T) {
+		db := sqliteInMem(t)
+		store := &batchRecordingStore{}
+		migrator := newMigrator(store, []migrate.SqlxMigration{
+			migrations[0],
+			migrate.SqlxQueryMigration("002_fail", "not valid sql", ""),
+		})
+		migrator.SingleTransaction = true
+		migrator.Savepoints = true
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want the error from 002_fail")
+		}
+		if want := [][]string{{ids[0]}}; !reflect.DeepEqual(store.batches, want) {
+			t.Errorf("batches = %v; want %v", store.batches, want)
+		}
+		assertApplied(t, db, ids[0])
+	})
+
+	t.Run("separate transactions", func(t *testing.T) {
+		db := sqliteInMem(t)
+		store := &batchRecordingStore{}
+		migrator := newMigrator(store, migrations[:3])
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		if !reflect.DeepEqual(store.inserted, ids[:3]) {
+			t.Errorf("inserted = %v; want %v", store.inserted, ids[:3])
+		}
+		if len(store.batches) != 0 {
+			t.Errorf("batches = %v; want none", store.batches)
+		}
+	})
+}
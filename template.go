@@ -0,0 +1,57 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SqlxTemplateMigration will create a SqlxMigration by rendering the provided
+// text/template strings with data. An empty downTmpl means the migration
+// won't have a Rollback.
+//
+// The templates are rendered when the migration is created so that the SQL is
+// available for checksums and dry runs, but any error parsing or executing
+// them isn't returned until the migration is run.
+func SqlxTemplateMigration(id, upTmpl, downTmpl string, data interface{}) SqlxMigration {
+	render := func(name, text string) (string, error) {
+		if text == "" {
+			return "", nil
+		}
+		tmpl, err := template.New(id + "." + name).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("migration %q: parsing %s template: %w", id, name, err)
+		}
+		var sb strings.Builder
+		err = tmpl.Execute(&sb, data)
+		if err != nil {
+			return "", fmt.Errorf("migration %q: executing %s template: %w", id, name, err)
+		}
+		return sb.String(), nil
+	}
+	queryFn := func(text, query string, err error) sqlExec {
+		if text == "" {
+			return nil
+		}
+		return func(tx *sqlx.Tx, rows *rowCounter) error {
+			if err != nil {
+				return err
+			}
+			return execCounted(tx, rows, query)
+		}
+	}
+
+	upQuery, upErr := render("up", upTmpl)
+	downQuery, downErr := render("down", downTmpl)
+	m := SqlxMigration{
+		ID:        id,
+		UpQuery:   upQuery,
+		DownQuery: downQuery,
+	}
+	m.upStep = newSQLStep(queryFn(upTmpl, upQuery, upErr))
+	m.Migrate = m.upStep.migrate()
+	m.Rollback = sqlRollback(queryFn(downTmpl, downQuery, downErr))
+	return m
+}
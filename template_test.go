@@ -0,0 +1,69 @@
+package migrate_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/joncalhoun/migrate"
+)
+
+func TestSqlxTemplateMigration(t *testing.T) {
+	data := struct {
+		Table string
+	}{
+		Table: "tenant_courses",
+	}
+
+	t.Run("renders", func(t *testing.T) {
+		db := sqliteInMem(t)
+		m := migrate.SqlxTemplateMigration("001_create_courses",
+			"CREATE TABLE {{.Table}} (id serial PRIMARY KEY, name text);",
+			"DROP TABLE {{.Table}};", data)
+		if want := "DROP TABLE tenant_courses;"; m.DownQuery != want {
+			t.Errorf("DownQuery = %q; want %q", m.DownQuery, want)
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{m},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Migrate() err = %v; want nil", err)
+		}
+		_, err = db.Exec("INSERT INTO tenant_courses (name) VALUES ('Gophercises')")
+		if err != nil {
+			t.Fatalf("db.Exec() err = %v; want nil", err)
+		}
+		err = migrator.Rollback(db, "sqlite3")
+		if err != nil {
+			t.Fatalf("Rollback() err = %v; want nil", err)
+		}
+		assertApplied(t, db)
+	})
+
+	t.Run("parse error", func(t *testing.T) {
+		db := sqliteInMem(t)
+		m := migrate.SqlxTemplateMigration("001_create_courses", "CREATE TABLE {{.Table (id int);", "", data)
+		if m.Rollback != nil {
+			t.Errorf("Rollback != nil; want nil")
+		}
+		migrator := migrate.Sqlx{
+			Printf: func(format string, args ...interface{}) (int, error) {
+				t.Logf(format, args...)
+				return 0, nil
+			},
+			Migrations: []migrate.SqlxMigration{m},
+		}
+		err := migrator.Migrate(db, "sqlite3")
+		if err == nil {
+			t.Fatalf("Migrate() err = nil; want an error")
+		}
+		if !strings.Contains(err.Error(), `"001_create_courses"`) {
+			t.Errorf("Migrate() err = %v; want it to include the migration ID", err)
+		}
+		assertApplied(t, db)
+	})
+}
@@ -0,0 +1,8 @@
+-- +migrate Up
+CREATE TABLE courses (
+  id serial PRIMARY KEY,
+  name text
+);
+
+-- +migrate Down
+DROP TABLE courses;
@@ -0,0 +1,2 @@
+INSERT INTO widgets (name) VALUES ('it\'s; escaped');
+INSERT INTO widgets (name) VALUES ("say \"hi;\"", 'back\\'); SELECT 1;
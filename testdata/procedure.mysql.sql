@@ -0,0 +1,14 @@
+CREATE TABLE widgets (
+  id INT AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(255) NOT NULL
+);
+
+DELIMITER //
+CREATE PROCEDURE add_widget(IN widget_name VARCHAR(255))
+BEGIN
+  INSERT INTO widgets (name) VALUES (widget_name);
+  SELECT LAST_INSERT_ID();
+END //
+DELIMITER ;
+
+CALL add_widget('first; widget');
@@ -0,0 +1,5 @@
+-- Seed courses; each statement is run on its own.
+INSERT INTO courses (name) VALUES ('semi;colon');
+INSERT INTO courses (name) VALUES ('it''s; quoted'); -- trailing; comment
+/* block; comment */
+INSERT INTO courses (name) VALUES ("double;quoted");
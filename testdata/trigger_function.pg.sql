@@ -0,0 +1,20 @@
+CREATE TABLE widgets (
+  id serial PRIMARY KEY,
+  name text NOT NULL,
+  updated_at timestamptz
+);
+
+CREATE FUNCTION set_updated_at() RETURNS trigger AS $$
+BEGIN
+  NEW.updated_at = now();
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE FUNCTION widget_label(w widgets) RETURNS text AS $body$
+  SELECT 'widget; ' || w.name;
+$body$ LANGUAGE sql;
+
+CREATE TRIGGER widgets_updated_at
+  BEFORE UPDATE ON widgets
+  FOR EACH ROW EXECUTE FUNCTION set_updated_at();
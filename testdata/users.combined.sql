@@ -0,0 +1,5 @@
+-- !up
+CREATE TABLE users (
+  id serial PRIMARY KEY,
+  email text UNIQUE NOT NULL
+);
@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Verify checks that the migrations recorded in the database are consistent
+// with the configured Migrations, such as for a periodic health check. It
+// only reads from the database: nothing is run or recorded, and the
+// migrations table isn't created if it doesn't exist, in which case there is
+// nothing to check. Every discrepancy found is returned, joined together:
+//
+//   - ErrDirtyState for migrations that failed partway through.
+//   - ErrChecksumMismatch for applied migrations whose SQL has since changed.
+//   - ErrOrphanedMigration for recorded migrations that aren't configured.
+//   - ErrOutOfOrder for a pending migration that sorts before one that has
+//     been applied, which usually means it was missed.
+//
+// Pending migrations that sort after every applied migration aren't an
+// error; use EnsureLatest to check for those.
+func (s *Sqlx) Verify(sqlDB *sql.DB, dialect string) error {
+	migrations, err := s.sortedMigrations()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	db, err := newDB(sqlDB, dialect)
+	if err != nil {
+		return err
+	}
+	missing, err := s.missingTable(ctx, db)
+	if err != nil {
+		return err
+	}
+	if missing {
+		return nil
+	}
+	// Unlike loadStatus, Stores that can't report whether their table
+	// exists are read without calling EnsureTable.
+	applied, err := s.appliedMigrations(ctx, db, s.store())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	var dirty []string
+	for id, a := range applied {
+		if a.Dirty {
+			dirty = append(dirty, id)
+		}
+	}
+	if len(dirty) > 0 {
+		sort.Slice(dirty, func(i, j int) bool {
+			return CompareIDs(dirty[i], dirty[j]) < 0
+		})
+		errs = append(errs, fmt.Errorf("%w: %q", ErrDirtyState, dirty))
+	}
+	var changed []string
+	for _, m := range migrations {
+		a, ok := applied[m.ID]
+		if !ok {
+			continue
+		}
+		sum := m.checksum()
+		if a.Checksum != "" && sum != "" && a.Checksum != sum {
+			changed = append(changed, m.ID)
+		}
+	}
+	if len(changed) > 0 {
+		errs = append(errs, fmt.Errorf("%w: %q", ErrChecksumMismatch, changed))
+	}
+	errs = append(errs, s.checkOrphaned(applied), checkOrder(migrations, applied))
+	return errors.Join(errs...)
+}